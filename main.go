@@ -3,6 +3,7 @@ package main
 import (
 	"io/ioutil"
 	"os"
+	"strconv"
 
 	"github.com/robfig/cron"
 	"github.com/rps-bot/rpsbot/rps"
@@ -30,6 +31,22 @@ var (
 		"roundTime",
 		"Time for each round (in seconds).",
 	).Default("10").Short('r').Uint()
+	rules = kingpin.Flag(
+		"rules",
+		"Rule set of the game: classic Rock-Paper-Scissors or Rock-Paper-Scissors-Lizard-Spock.",
+	).Default("classic").Enum("classic", "rpsls")
+	bestOf = kingpin.Flag(
+		"bestOf",
+		"Number of throws each match is played best of.",
+	).Default("1").Enum("1", "3", "5")
+	drawTimeout = kingpin.Flag(
+		"drawTimeout",
+		"How much a match can spend on replaying draws before a coin flip (in seconds).",
+	).Default("30").Uint()
+	changeMove = kingpin.Flag(
+		"changeMove",
+		"Let players change their move until the time of the throw is over.",
+	).Default("false").Bool()
 	payTime = kingpin.Flag(
 		"payTime",
 		"Time to perform a payment (in minutes).",
@@ -42,6 +59,10 @@ var (
 		"ticketPrice",
 		"Price of each ticket.",
 	).Default("0.001").Short('p').Float64()
+	ticketLifetime = kingpin.Flag(
+		"ticketLifetime",
+		"Lifetime of a ticket, 0 means tickets never expire (in hours).",
+	).Default("168").Uint()
 	testnet = kingpin.Flag(
 		"testnet",
 		"Run bot on testnet.",
@@ -50,10 +71,38 @@ var (
 		"donationAddress",
 		"Address to donate to.",
 	).String()
+	minWithdrawal = kingpin.Flag(
+		"minWithdrawal",
+		"Minimum amount a user can withdraw from the balance.",
+	).Default("0.002").Float64()
+	feePercent = kingpin.Flag(
+		"feePercent",
+		"House fee taken from the tickets of each game (in percents).",
+	).Default("0").Float64()
+	feePerTicket = kingpin.Flag(
+		"feePerTicket",
+		"House fee taken from each ticket.",
+	).Default("0").Float64()
+	operatorAddress = kingpin.Flag(
+		"operatorAddress",
+		"Address the house fee is sent to.",
+	).String()
+	operatorID = kingpin.Flag(
+		"operatorID",
+		"Chat ID of the operator allowed to use operator commands.",
+	).Int64()
+	prizeStrategy = kingpin.Flag(
+		"prizeStrategy",
+		"Prize distribution: progressive, winner, top:N or fixed:P1,P2,... (in percents).",
+	).Default("progressive").String()
 	dbPath = kingpin.Flag(
 		"dbPath",
-		"Path to the level db.",
+		"Path to the database.",
 	).Default("./db").Short('d').String()
+	storageBackend = kingpin.Flag(
+		"storage",
+		"Storage backend (leveldb or sqlite).",
+	).Default("leveldb").Enum("leveldb", "sqlite")
 	cashboxWalletPath = kingpin.Flag(
 		"cashboxWalletPath",
 		"Path to the \"cashbox\" wallet.",
@@ -62,18 +111,58 @@ var (
 		"bankWalletPath",
 		"Path to the \"bank\" wallet.",
 	).Default("~/.electron-cash/wallets/bank_wallet").String()
+	apiURL = kingpin.Flag(
+		"apiURL",
+		"Base URL of the Telegram Bot API.",
+	).Default(rps.DefaultAPIURL).String()
 	verbose = kingpin.Flag(
 		"verbose",
 		"Verbose logging mode.",
 	).Short('v').Bool()
-	token = kingpin.Arg(
+	runCommand = kingpin.Command(
+		"run",
+		"Run the bot.",
+	).Default()
+	token = runCommand.Arg(
 		"token",
 		"Bot's token.",
 	).Required().String()
+	replayCommand = kingpin.Command(
+		"replay",
+		"Replay stored games offline and check that winners and payouts match the records.",
+	)
+	replayGameIDs = replayCommand.Arg(
+		"gameID",
+		"IDs of the games to replay, all the finished games are replayed by default.",
+	).Uint64List()
 )
 
 func main() {
-	kingpin.Parse()
+	command := kingpin.Parse()
+
+	// Loggers are ready before the flags are checked, so their errors are reported
+	if *verbose {
+		rps.LogsInit(os.Stdout, os.Stdout, os.Stdout, os.Stderr)
+	} else {
+		rps.LogsInit(ioutil.Discard, os.Stdout, os.Stdout, os.Stderr)
+	}
+
+	strategy, err := rps.ParsePrizeStrategy(*prizeStrategy, *ticketPrice)
+	if err != nil {
+		rps.Error.Println("Can't parse the prize strategy")
+		panic(err)
+	}
+	if err := rps.CheckHouseFee(*feePercent, *feePerTicket, *ticketPrice, *operatorAddress); err != nil {
+		rps.Error.Println("Can't set up the house fee")
+		panic(err)
+	}
+	ruleSet, err := rps.ParseRuleSet(*rules)
+	if err != nil {
+		rps.Error.Println("Can't parse the rule set")
+		panic(err)
+	}
+	// Enum guarantees the value is a number
+	throws, _ := strconv.ParseUint(*bestOf, 10, 32)
 	opts := rps.NewOptions(
 		*capacity,
 		*timeout,
@@ -83,26 +172,50 @@ func main() {
 		*payTime,
 		*schedule,
 		*ticketPrice,
-		*testnet,
 		*donationAddress,
-		*dbPath,
-		*cashboxWalletPath,
-		*bankWalletPath,
+		*minWithdrawal,
+		*ticketLifetime,
+		*operatorID,
+		strategy,
+		*feePercent,
+		*feePerTicket,
+		*operatorAddress,
+		uint(throws),
+		*drawTimeout,
+		ruleSet,
+		*changeMove,
 	)
+	cashbox := rps.NewElectronCash(*cashboxWalletPath, *testnet)
+	bank := rps.NewElectronCash(*bankWalletPath, *testnet)
 
-	if *verbose {
-		rps.LogsInit(os.Stdout, os.Stdout, os.Stdout, os.Stderr)
-	} else {
-		rps.LogsInit(ioutil.Discard, os.Stdout, os.Stdout, os.Stderr)
+	storage, err := rps.OpenStorage(*storageBackend, *dbPath)
+	if err != nil {
+		rps.Error.Println("Can't open the storage")
+		panic(err)
+	}
+
+	// Games are replayed with the match format and prizes kept in their records,
+	// the options are used only for the games recorded before they were kept
+	if command == replayCommand.FullCommand() {
+		failed := rps.ReplayGames(rps.NewGames("games", storage), *replayGameIDs, &opts)
+		storage.Close()
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
 	}
 
-	users := rps.Users{}
-	requests, stats, names := rps.LDBMap{}, rps.LDBMap{}, rps.LDBMap{}
 	players := []int64{}
 	leaderboard := []*rps.User{}
 
+	telegram, err := rps.NewTelegram(*token, *apiURL)
+	if err != nil {
+		rps.Error.Println("Can't authenticate with given token")
+		panic(err)
+	}
+
 	crn := cron.New()
 	crn.Start()
-	bot := rps.New(*token, &opts, crn, &users, &requests, &stats, &names, players, &leaderboard)
+	bot := rps.New(telegram, &opts, crn, cashbox, bank, storage, players, &leaderboard)
 	bot.Start()
 }
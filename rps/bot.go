@@ -2,94 +2,108 @@ package rps
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/Pallinder/go-randomdata"
-	"github.com/Syfaro/telegram-bot-api"
 	"github.com/robfig/cron"
 )
 
 var payChannels, clientOpTimeout, clientModifyChannels = NewSynMap(), NewSynMap(), NewSynMap()
 
+// Signals of the throws waiting for moves keyed by user ID.
+var moveSignals = NewSynMap()
+
 type compare func(interface{}, interface{}) bool
 
+// Number of users shown in the leaderboard.
+const leaderboardSize = 10
+
+// Number of games shown in the history.
+const historySize = 5
+
+// Number of queued tickets shown to the operator.
+const queueSize = 50
+
+// Maximum number of tickets a user can have.
+const maxTickets = 10
+
+// Numbers of tickets a user can buy at once.
+var ticketBundles = []int{1, 3, 5}
+
+// How often failed payouts are checked for the next attempt.
+const payoutRetryInterval = 30 * time.Second
+
 // Bot strcture.
 type Bot struct {
-	token       string
+	transport   Transport
 	opts        *Options
 	crn         *cron.Cron
+	cashbox     Wallet
+	bank        Wallet
+	storage     Storage
 	users       *Users
-	requests    *LDBMap
-	stats       *LDBMap
-	names       *LDBMap
+	requests    KVStore
+	stats       KVStore
+	names       KVStore
+	seeds       KVStore
+	games       *Games
+	game        *GameRecord
+	state       *GameState
+	ledger      *Ledger
+	queue       *TicketQueue
 	players     []int64
 	leaderboard *[]*User
 }
 
 // New creates an object of Bot structure.
 func New(
-	token string,
+	transport Transport,
 	opts *Options,
 	crn *cron.Cron,
-	users *Users,
-	requests *LDBMap,
-	stats *LDBMap,
-	names *LDBMap,
+	cashbox Wallet,
+	bank Wallet,
+	storage Storage,
 	players []int64,
 	leaderboard *[]*User,
 ) Bot {
-	b := Bot{token, opts, crn, users, requests, stats, names, players, leaderboard}
+	b := Bot{transport, opts, crn, cashbox, bank, storage, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil,
+		players, leaderboard}
 	return b
 }
 
-var mainKeyboard = tgbotapi.NewReplyKeyboard(
-	tgbotapi.NewKeyboardButtonRow(
-		tgbotapi.NewKeyboardButton("\U0001f39f BuyTicket"),
-		tgbotapi.NewKeyboardButton("\U0001f4ec Subscribe"),
-		tgbotapi.NewKeyboardButton("\U0001f3ad Change name"),
+var mainKeyboard = NewKeyboard(
+	NewButtonRow(
+		"\U0001f39f BuyTicket",
+		"\U0001f4ec Subscribe",
+		"\U0001f3ad Change name",
 	),
-	tgbotapi.NewKeyboardButtonRow(
-		tgbotapi.NewKeyboardButton("\U0001f5d1 Reset"),
-		tgbotapi.NewKeyboardButton("\U0001f4ed Unsubscribe"),
-		tgbotapi.NewKeyboardButton("\U0001f4b3 Change wallet address"),
+	NewButtonRow(
+		"\U0001f5d1 Reset",
+		"\U0001f4ed Unsubscribe",
+		"\U0001f4b3 Change wallet address",
 	),
-	tgbotapi.NewKeyboardButtonRow(
-		tgbotapi.NewKeyboardButton("\U00002753 Help"),
-		tgbotapi.NewKeyboardButton("\U0001f50d Status"),
-		tgbotapi.NewKeyboardButton("\U0001f3c6 Leaderboard"),
+	NewButtonRow(
+		"\U00002753 Help",
+		"\U0001f50d Status",
+		"\U0001f3c6 Leaderboard",
 	),
-)
-
-var gameKeyboard = tgbotapi.NewReplyKeyboard(
-	tgbotapi.NewKeyboardButtonRow(
-		tgbotapi.NewKeyboardButton("\U000026f0 Rock"),
-		tgbotapi.NewKeyboardButton("\U0001f4c4 Paper"),
-		tgbotapi.NewKeyboardButton("\U00002702 Scissors"),
+	NewButtonRow(
+		"\U0001f4dc History",
+		"\U0001f4b8 Withdraw",
 	),
 )
 
 func replyTo(
 	chatID int64,
 	reply string,
-	botAPI *tgbotapi.BotAPI,
-	markup interface{},
+	transport Transport,
+	keyboard Keyboard,
 ) {
-	msg := tgbotapi.NewMessage(chatID, reply)
-	//msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
-	msg.ParseMode = "markdown"
-	switch t := markup.(type) {
-	default:
-		Warning.Printf("Unexpected type %T", t)
-	case tgbotapi.InlineKeyboardMarkup:
-		msg.ReplyMarkup = markup.(tgbotapi.InlineKeyboardMarkup)
-	case tgbotapi.ReplyKeyboardMarkup:
-		msg.ReplyMarkup = markup.(tgbotapi.ReplyKeyboardMarkup)
-	}
-	if _, err := botAPI.Send(msg); err != nil {
+	if err := transport.Send(chatID, reply, keyboard); err != nil {
 		Error.Printf("Can't send reply to %d\n\t%s",
 			chatID, err)
 	}
@@ -98,11 +112,11 @@ func replyTo(
 func replyToMany(
 	ids []int64,
 	reply string,
-	botAPI *tgbotapi.BotAPI,
-	markup interface{},
+	transport Transport,
+	keyboard Keyboard,
 ) {
 	for _, id := range ids {
-		replyTo(id, reply, botAPI, markup)
+		replyTo(id, reply, transport, keyboard)
 	}
 }
 
@@ -150,44 +164,69 @@ func watchClientModify(chatID int64, channels *SynMap, opts *Options) string {
 ////////////****************************************************////////////
 
 // Welcome to everyone.
-func (b *Bot) Welcome(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
+func (b *Bot) Welcome(chatID int64) {
 	reply := ""
-	chatID := update.Message.Chat.ID
+
+	houseRules := "*This bot doesn't take any of your money so the entire bank " +
+		"pays out to players except Bitcoin Cash fees.*"
+	moveRules := "Your first move of each throw is final. "
+	if b.opts.changeMove {
+		moveRules = "You can change your move until the time of the throw is over. "
+	}
+	matchFormat := ""
+	if b.opts.bestOf > 1 {
+		matchFormat = fmt.Sprintf("Each match is played best of %d throws. ", b.opts.bestOf)
+	}
+	if fee := feeDescription(b.opts); fee != "" {
+		houseRules = fmt.Sprintf("*This bot takes a house fee of %s, the rest of the bank "+
+			"pays out to players except Bitcoin Cash fees.*", fee)
+	}
 
 	reply = fmt.Sprintf(
-		"*Hello and welcome to Rock-Paper-Scissors Online!*\n\n" +
-
-			"Here you can play Rock-Paper-Scissors with others " +
-			"as well as win some crypto currency. Rules are simple: " +
-			"rock beat scissors, scissors beat paper and paper beat rock. " +
-			"In case of two players choose the same item winner will be picked by random. " +
-			"If you didn't make a move it will be made automatically by random pick of " +
-			"rock, paper or scissors. Also there is special prize distribution: " +
-			"the game is lost for you *only* if you're lost in the very first round " +
-			"any other outcome is at least non-loss. For example, if you lose on the " +
-			"second round you get your money back, if you lose on the " +
-			"third round you get x2 of ticket price, if you lose on the " +
-			"fourth round you get x3 of ticket price and so on. The final winner " +
-			"get a special prize - all the non raffled money.\n\n" +
-
-			"*Don't forget* to set up your wallet address otherwise your money " +
-			"remain in the bank until somebody else win it!\n\n" +
-
-			"*Commands you can use:*\n\n" +
-
-			"/buyticket - buy a ticket\n" +
-			"/reset - discard a payment request\n" +
-			"/subscribe - subscribe onto the bot notifications\n" +
-			"/unsubscribe - unsubscribe from the bot notifications\n" +
-			"/status - current status of the game e.g. schedule, ticket price, etc.\n" +
-			"/help - this message\n" +
-			"/rock - make a move with rock\n" +
-			"/paper - make a move with paper\n" +
-			"/scissors - make a move with scissors\n" +
-			"/leaderboard - show the leaderboard\n\n" +
-
-			"*This bot doesn't take any of your money so the entire bank " +
-			"pays out to players except Bitcoin Cash fees.*",
+		"*Hello and welcome to %s Online!*\n\n"+
+
+			"Here you can play %s with others "+
+			"as well as win some crypto currency. Rules are simple: %s. "+
+			"%s"+
+			"In case of two players choose the same item the throw is replayed, "+
+			"if draws take too long the winner is picked by random. "+
+			"If you didn't make a move it will be made automatically by random pick of "+
+			"%s. %sEach move is locked with a hash commitment which is revealed "+
+			"when the throw is over, so results can be checked afterwards. "+
+			"Also there is special prize distribution: %s "+
+			"If the number of players isn't a power of two some players pass "+
+			"the first round without a match, it doesn't count as a win. "+
+			"Money which isn't paid out in a game is rolled over to the jackpot "+
+			"and added to the pot of the next game.\n\n"+
+
+			"*Don't forget* to set up your wallet address otherwise your winnings "+
+			"are kept on your balance until you set it and /withdraw them!\n\n"+
+
+			"*Commands you can use:*\n\n"+
+
+			"/buyticket - buy tickets for the next games\n"+
+			"/reset - discard a payment request\n"+
+			"/subscribe - subscribe onto the bot notifications\n"+
+			"/unsubscribe - unsubscribe from the bot notifications\n"+
+			"/status - current status of the game e.g. schedule, ticket price, etc.\n"+
+			"/help - this message\n"+
+			"%s"+
+			"/leaderboard - show the leaderboard\n"+
+			"/history - show your last games\n"+
+			"/withdraw - send your balance to your wallet\n"+
+			"/verify <game ID> - check that results of the game are fair\n"+
+			"/seed <text> - set your part of the client seed of the next games\n\n"+
+
+			"%s",
+		b.opts.rules.Name(),
+		b.opts.rules.Name(),
+		b.opts.rules.Description(),
+		matchFormat,
+		b.opts.rules.MoveNames(),
+		moveRules,
+		b.opts.prizeStrategy.Description(),
+		b.opts.rules.Commands(),
+		houseRules,
 	)
 
 	if b.opts.donationAddress != "" {
@@ -195,69 +234,205 @@ func (b *Bot) Welcome(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
 			b.opts.donationAddress)
 	}
 
-	replyTo(chatID, reply, botAPI, mainKeyboard)
+	replyTo(chatID, reply, b.transport, mainKeyboard)
 }
 
-// BuyTicket handles ticket purchase.
-func (b *Bot) BuyTicket(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
+// canBuyTicket checks if user is able to buy count tickets and replies the reason if not.
+func (b *Bot) canBuyTicket(chatID int64, count int) bool {
 	reply := ""
-	chatID := update.Message.Chat.ID
-	replyError := func() {
-		reply = "Something went wrong while processing request, please try again later."
-		replyTo(chatID, reply, botAPI, mainKeyboard)
-	}
 
 	if !b.users.Exist(chatID) || b.users.Exist(chatID) && !b.users.Get(chatID).GetSubscribed() {
-		needToBeSubscribed(chatID, botAPI)
-		return
+		needToBeSubscribed(chatID, b.transport)
+		return false
 	}
 
 	if b.requests.Exist(strconv.FormatInt(chatID, 10)) {
 		reply = "You are in process of ticket purchase already."
-		replyTo(chatID, reply, botAPI, mainKeyboard)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return false
+	}
+
+	if tickets := len(b.users.Get(chatID).GetTickets()); tickets+count > maxTickets {
+		reply = fmt.Sprintf("You can't have more than %d tickets, you have %d already.",
+			maxTickets, tickets)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return false
+	}
+
+	return true
+}
+
+// newTickets creates count tickets expiring after the ticket lifetime.
+func newTickets(count int, fromBalance bool, opts *Options) []Ticket {
+	tickets := []Ticket{}
+	now := time.Now()
+	expires := time.Time{}
+	if opts.ticketLifetime != 0 {
+		expires = now.Add(time.Duration(opts.ticketLifetime) * time.Hour)
+	}
+	for i := 0; i < count; i++ {
+		tickets = append(tickets, Ticket{0, now, expires, fromBalance})
+	}
+
+	return tickets
+}
+
+// giveTickets gives the tickets to the user and puts them into the queue at once.
+func (b *Bot) giveTickets(user *User, tickets []Ticket) error {
+	if err := b.queue.AssignIDs(tickets); err != nil {
+		return err
+	}
+
+	old := user.GetTickets()
+	user.AddTickets(tickets...)
+	user.SetLastTicketDate(time.Now())
+	err := b.storage.Update(func(tx *Tx) error {
+		b.users.TxPut(tx, user.GetUserID(), user)
+		b.queue.TxPush(tx, user.GetUserID(), tickets...)
+		return nil
+	})
+	if err != nil {
+		user.SetTickets(old)
+	}
+
+	return err
+}
+
+// parseTicketCount returns number of tickets of a bundle or 0 if there is no such bundle.
+func parseTicketCount(s string) int {
+	count, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	for _, c := range ticketBundles {
+		if c == count {
+			return count
+		}
+	}
+
+	return 0
+}
+
+// BuyTicket handles ticket purchase.
+// User chooses how many tickets to buy, each one plays in one of the next games.
+func (b *Bot) BuyTicket(chatID int64) {
+	if !b.canBuyTicket(chatID, 1) {
 		return
 	}
 
-	if b.users.Exist(chatID) && b.users.Get(chatID).GetHasTicket() {
-		reply = "You already have one!"
-		replyTo(chatID, reply, botAPI, mainKeyboard)
+	reply := "How many tickets would you like to buy? Each ticket plays in one of the next games."
+	if b.opts.ticketLifetime != 0 {
+		reply += fmt.Sprintf(" Tickets which didn't play in *%d hours* are returned to your balance.",
+			b.opts.ticketLifetime)
+	}
+	row := []Button{}
+	for _, count := range ticketBundles {
+		row = append(row, Button{strconv.Itoa(count), fmt.Sprintf("tickets %d", count)})
+	}
+	replyTo(chatID, reply, b.transport, NewInlineKeyboard(row))
+}
+
+// ChooseTicketPayment asks how to pay for count tickets.
+// Users having not enough balance pay on-chain right away.
+func (b *Bot) ChooseTicketPayment(chatID int64, count int) {
+	if !b.canBuyTicket(chatID, count) {
+		return
+	}
+
+	user := b.users.Get(chatID)
+	if user.GetBalance() < float64(count)*b.opts.ticketPrice {
+		b.BuyTicketOnChain(chatID, count)
 		return
 	}
 
-	address, url, err := CreateRequest(b.opts.ticketPrice, b.opts.cashboxWalletPath, b.opts.testnet)
+	reply := fmt.Sprintf("How would you like to pay for *%d* tickets? Your balance is *%f BCH*.",
+		count, user.GetBalance())
+	markup := NewInlineKeyboard(
+		[]Button{{"Pay from balance", fmt.Sprintf("balance %d", count)}},
+		[]Button{{"Pay on-chain", fmt.Sprintf("onchain %d", count)}},
+	)
+	replyTo(chatID, reply, b.transport, markup)
+}
+
+// BuyTicketFromBalance buys count tickets by debiting balance of the user.
+func (b *Bot) BuyTicketFromBalance(chatID int64, count int) {
+	reply := ""
+
+	if !b.canBuyTicket(chatID, count) {
+		return
+	}
+
+	user := b.users.Get(chatID)
+	price := float64(count) * b.opts.ticketPrice
+	if !user.Debit(price) {
+		reply = fmt.Sprintf("There isn't enough funds on your balance, it's *%f BCH*.",
+			user.GetBalance())
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return
+	}
+
+	balance := user.GetBalance()
+	if err := b.giveTickets(user, newTickets(count, true, b.opts)); err != nil {
+		Error.Printf("Can't give a ticket to the player:\n\tChatID: %d\n\t%s", chatID, err)
+		user.AddBalance(price)
+		reply = "Something went wrong while processing request, please try again later."
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return
+	}
+	Info.Printf("Tickets paid from the balance:\n\tChatID: %d\n\tCount: %d\n\tBalance: %f",
+		chatID, count, balance)
+
+	reply = fmt.Sprintf("You've got *%d* tickets \U0001f39f Your balance is *%f BCH* now. "+
+		"To check current game schedule type /status.", count, balance)
+	replyTo(chatID, reply, b.transport, mainKeyboard)
+}
+
+// BuyTicketOnChain buys count tickets by creating a payment request.
+func (b *Bot) BuyTicketOnChain(chatID int64, count int) {
+	reply := ""
+	replyError := func() {
+		reply = "Something went wrong while processing request, please try again later."
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+	}
+
+	if !b.canBuyTicket(chatID, count) {
+		return
+	}
+
+	price := float64(count) * b.opts.ticketPrice
+	address, url, err := b.cashbox.CreateRequest(price)
 	if err != nil {
 		Error.Printf("Can't create a new request:\n\t%s", err)
 		replyError()
 		return
 	}
-	if err := registerRequest(chatID, address, b.requests, &payChannels); err != nil {
+	if err := registerRequest(chatID, address, count, b.requests, &payChannels); err != nil {
 		Error.Printf("Can't create a new request:\n\t%s", err)
 		replyError()
 		return
 	}
 
 	reply = fmt.Sprintf("*%s*", url)
-	replyTo(chatID, reply, botAPI, mainKeyboard)
+	replyTo(chatID, reply, b.transport, mainKeyboard)
 	reply = fmt.Sprintf("Okay, now you've got *%d minutes* to pay *%f BCH* to the address above.\n\n"+
 		"If you wish to discard this request just type /reset or click to *Reset* button. "+
 		"It's *NOT* recommended to reset paid transaction.",
-		b.opts.payTime, b.opts.ticketPrice)
-	replyTo(chatID, reply, botAPI, mainKeyboard)
+		b.opts.payTime, price)
+	replyTo(chatID, reply, b.transport, mainKeyboard)
 
-	go b.processBuyTicket(chatID, &payChannels, botAPI)
+	go b.processBuyTicket(chatID, &payChannels)
 }
 
 // Reset resets ticket purchase and any active modifying actions.
-func (b *Bot) Reset(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
+func (b *Bot) Reset(chatID int64) {
 	reply := ""
-	chatID := update.Message.Chat.ID
 
 	if !b.users.Exist(chatID) || b.users.Exist(chatID) && !b.users.Get(chatID).GetSubscribed() {
-		needToBeSubscribed(chatID, botAPI)
+		needToBeSubscribed(chatID, b.transport)
 		return
 	}
 
-	replyTo(chatID, "Reseting in progress, please wait up to 15 seconds.", botAPI, mainKeyboard)
+	replyTo(chatID, "Reseting in progress, please wait up to 15 seconds.", b.transport, mainKeyboard)
 
 	if clientModifyChannels.Exist(chatID) {
 		ch := clientModifyChannels.Get(chatID).(chan string)
@@ -265,14 +440,14 @@ func (b *Bot) Reset(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
 	}
 
 	if b.requests.Exist(strconv.FormatInt(chatID, 10)) {
-		requestID := b.requests.Get(strconv.FormatInt(chatID, 10))
+		requestID, _ := parseRequest(b.requests.Get(strconv.FormatInt(chatID, 10)))
 		if err := unregisterRequest(chatID, b.requests, &payChannels); err != nil {
 			Warning.Printf("Can't unregister request:\n\tChatID: %d\n\t%s", chatID, err)
 			reply = "Something went wrong, please try again."
-			replyTo(chatID, reply, botAPI, mainKeyboard)
+			replyTo(chatID, reply, b.transport, mainKeyboard)
 			return
 		}
-		if err := RemoveRequest(requestID, b.opts.cashboxWalletPath, b.opts.testnet); err != nil {
+		if err := b.cashbox.RemoveRequest(requestID); err != nil {
 			Error.Printf("Can't remove request:\n\tRequestID: %s\n\t%s", requestID, err)
 		}
 		Verbose.Printf("Reset successfully:\n\tChatID: %d\n\tRequestID: %s",
@@ -283,14 +458,13 @@ func (b *Bot) Reset(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
 		reply = "You have no transactions to reset."
 	}
 
-	replyTo(chatID, reply, botAPI, mainKeyboard)
+	replyTo(chatID, reply, b.transport, mainKeyboard)
 }
 
 // Subscribe enables notifications for user.
 // Without subscription almost any action isn't available
-func (b *Bot) Subscribe(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
+func (b *Bot) Subscribe(chatID int64, userName string) {
 	reply := "You're now subscribed!"
-	chatID := update.Message.Chat.ID
 
 	if b.users.Exist(chatID) && b.users.Get(chatID).GetSubscribed() {
 		reply = "You're subscribed already."
@@ -303,79 +477,79 @@ func (b *Bot) Subscribe(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
 			reply = "Something went wrong, please try again."
 		}
 	} else {
-		name := update.Message.Chat.UserName
+		name := userName
 		for name == "" || b.names.Exist(name) || !NameValidate(name) {
 			name = randomdata.SillyName()
 		}
-		if err := b.names.Put(name, ""); err != nil {
-			Error.Printf("Can't save generated name:\n\tChatID: %d\n\tName: %s",
-				chatID, name)
-			reply = "Something went wrong, please try again."
-			replyTo(chatID, reply, botAPI, mainKeyboard)
-			return
-		}
 		user := NewUser(chatID, name, true, false, false, uint32(b.users.Len()+1))
-		if err := b.users.Put(chatID, &user); err != nil {
-			Error.Printf("Can't subscribe:\n\tChatID: %d\n\t%s",
-				chatID, err)
+		err := b.storage.Update(func(tx *Tx) error {
+			b.names.TxPut(tx, name, "")
+			b.users.TxPut(tx, chatID, &user)
+			return nil
+		})
+		if err != nil {
+			Error.Printf("Can't subscribe:\n\tChatID: %d\n\tName: %s\n\t%s",
+				chatID, name, err)
 			reply = "Something went wrong, please try again."
 		}
 	}
 
-	replyTo(chatID, reply, botAPI, mainKeyboard)
+	replyTo(chatID, reply, b.transport, mainKeyboard)
 }
 
 // Unsubscribe disables notifications for user.
-func (b *Bot) Unsubscribe(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
-	var markup tgbotapi.InlineKeyboardMarkup
-	chatID := update.Message.Chat.ID
-
+func (b *Bot) Unsubscribe(chatID int64) {
 	if b.users.Exist(chatID) && b.users.Get(chatID).GetHasTicket() {
-		reply := "You'll lose your ticket. Are you sure you want to unsubscribe?"
-		yes := tgbotapi.NewInlineKeyboardButtonData("Yes", "yes")
-		no := tgbotapi.NewInlineKeyboardButtonData("No", "no")
-		markup.InlineKeyboard = append(markup.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
-			yes, no,
-		))
-		replyTo(chatID, reply, botAPI, markup)
+		reply := "You'll lose your tickets. Are you sure you want to unsubscribe?"
+		markup := NewInlineKeyboard([]Button{{"Yes", "yes"}, {"No", "no"}})
+		replyTo(chatID, reply, b.transport, markup)
 	} else {
-		b.YesUnsubscribe(update, botAPI)
+		b.YesUnsubscribe(chatID)
 	}
 }
 
-func needToBeSubscribed(chatID int64, botAPI *tgbotapi.BotAPI) {
+func needToBeSubscribed(chatID int64, transport Transport) {
 	reply := "To perform this operation you need to subscribe."
-	replyTo(chatID, reply, botAPI, mainKeyboard)
+	replyTo(chatID, reply, transport, mainKeyboard)
 }
 
 // Status shows status message filled up with user's stats.
-func (b *Bot) Status(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
+func (b *Bot) Status(chatID int64) {
 	var user *User
 	reply := ""
-	chatID := update.Message.Chat.ID
 
 	if b.users.Exist(chatID) {
 		user = b.users.Get(chatID)
 	} else {
-		needToBeSubscribed(chatID, botAPI)
+		needToBeSubscribed(chatID, b.transport)
 		return
 	}
 
 	if !user.GetSubscribed() {
-		needToBeSubscribed(chatID, botAPI)
+		needToBeSubscribed(chatID, b.transport)
 		return
 	}
 
 	reply = fmt.Sprintf("_%s_ (_%d_)\n", user.GetName(), user.GetUserID())
 
 	reply += fmt.Sprintf(
-		"\n\U0001f48e Ticket price: *%0.3f BTH*\n\U0001f551 Next game launch: *%s*",
+		"\n\U0001f48e Ticket price: *%0.3f BTH*\n\U0001f3b0 Jackpot: *%f BCH*"+
+			"\n\U0001f551 Next game launch: *%s*",
 		b.opts.ticketPrice,
+		getJackpot(b.stats),
 		b.crn.Entries()[0].Next.Format(time.RFC1123),
 	)
+	if fee := feeDescription(b.opts); fee != "" {
+		reply += fmt.Sprintf("\n\U0001f3e0 House fee: *%s*", fee)
+	}
+	reply += fmt.Sprintf("\n\U0001f510 Next game seed hash: `%s`", b.nextSeedHash())
 
-	if user.GetHasTicket() {
-		reply += "\n\U0001f3b2 You *have* a ticket"
+	if tickets := user.GetTickets(); len(tickets) > 0 {
+		reply += fmt.Sprintf("\n\U0001f3b2 You *have %d* tickets", len(tickets))
+		if !tickets[0].Expires.IsZero() {
+			reply += fmt.Sprintf(", the next one expires *%s*", tickets[0].Expires.Format(time.RFC1123))
+		}
+		reply += fmt.Sprintf("\n\U0001f6b6 Your place in the queue: *%d*", b.queue.Position(chatID))
 	} else {
 		reply += "\n\U0001f614 You *have no* ticket"
 	}
@@ -384,49 +558,254 @@ func (b *Bot) Status(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
 
 	reply += fmt.Sprintf("\n\U0001f4b0 Your total won amount: *%f*", user.GetTotalWonAmount())
 
+	reply += fmt.Sprintf("\n\U0001f45b Your balance: *%f BCH*", user.GetBalance())
+
 	reply += fmt.Sprintf("\n\U0001f3c5 Your position in the leaderboard is *%d* of *%d*",
 		user.GetLeaderboardPosition(), b.users.Len())
 
-	replyTo(chatID, reply, botAPI, mainKeyboard)
+	replyTo(chatID, reply, b.transport, mainKeyboard)
 }
 
 // Leaderboard shows leaderboard message.
-func (b *Bot) Leaderboard(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
+func (b *Bot) Leaderboard(chatID int64) {
 	reply := ""
-	chatID := update.Message.Chat.ID
 
 	if b.users.Exist(chatID) {
 		if len(*b.leaderboard) > 0 {
-			for i, el := range (*b.leaderboard)[:Min(10, len(*b.leaderboard))] {
+			for i, el := range (*b.leaderboard)[:Min(leaderboardSize, len(*b.leaderboard))] {
 				reply += fmt.Sprintf("%d. %s\t\t%f\n", i+1, el.GetName(), el.GetTotalWonAmount())
 			}
 		} else {
 			reply = "Leaderboard is empty yet."
 		}
-		replyTo(chatID, reply, botAPI, mainKeyboard)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
 	} else {
-		needToBeSubscribed(chatID, botAPI)
+		needToBeSubscribed(chatID, b.transport)
 	}
 }
 
+// History shows last games of the user round by round.
+func (b *Bot) History(chatID int64) {
+	reply := ""
+
+	if !b.users.Exist(chatID) {
+		needToBeSubscribed(chatID, b.transport)
+		return
+	}
+
+	games := b.games.ForUser(chatID, historySize)
+	if len(games) == 0 {
+		reply = "You haven't played any game yet."
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return
+	}
+
+	for _, game := range games {
+		reply += formHistoryEntry(&game, chatID) + "\n"
+	}
+	replyTo(chatID, reply, b.transport, mainKeyboard)
+}
+
+// Queue shows the ticket queue to the operator.
+func (b *Bot) Queue(chatID int64) {
+	entries := b.queue.List()
+	reply := fmt.Sprintf("*%d* tickets of *%d* players in the queue:\n",
+		len(entries), len(b.queue.Players()))
+
+	for i, entry := range entries[:Min(queueSize, len(entries))] {
+		name := ""
+		if b.users.Exist(entry.UserID) {
+			name = b.users.Get(entry.UserID).GetName()
+		}
+		reply += fmt.Sprintf("%d. %s (%d) #%d %s\n", i+1, name, entry.UserID, entry.TicketID,
+			entry.Purchased.Format(time.RFC1123))
+	}
+	if len(entries) > queueSize {
+		reply += "..."
+	}
+
+	replyTo(chatID, reply, b.transport, mainKeyboard)
+}
+
+// Verify recomputes results of the game from its revealed seeds.
+func (b *Bot) Verify(chatID int64, args []string) {
+	reply := ""
+
+	if len(args) != 1 {
+		reply = "Please specify ID of the game, e.g. /verify 1"
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return
+	}
+	gameID, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		reply = "Game ID must be a number, e.g. /verify 1"
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return
+	}
+	game, err := b.games.Get(gameID)
+	if err != nil {
+		reply = fmt.Sprintf("There is no game #%d.", gameID)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return
+	}
+	if !game.Finished() {
+		reply = fmt.Sprintf("Game #%d isn't over yet, its server seed is revealed when it ends.\n"+
+			"Server seed hash: `%s`", gameID, game.ServerSeedHash)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return
+	}
+
+	reply = fmt.Sprintf("\U0001f3ae *Game #%d*\nServer seed: `%s`\nServer seed hash: `%s`\n"+
+		"Client seed: `%s`\n\n", gameID, game.ServerSeed, game.ServerSeedHash, game.ClientSeed)
+	if problems := VerifyGame(&game); len(problems) > 0 {
+		reply += "\U0000274c Results don't match the seeds:\n" + strings.Join(problems, "\n")
+	} else {
+		reply += "\U00002705 Pairings, automatic moves, coin flips and winners match the seeds."
+	}
+	replyTo(chatID, reply, b.transport, mainKeyboard)
+}
+
+// Seed sets seed the user adds to the client seed of its next games.
+func (b *Bot) Seed(chatID int64, args []string) {
+	reply := ""
+
+	if len(args) == 0 {
+		reply = "Your seed is added to the client seed of your games, so the results can't be " +
+			"picked in advance. Set it with /seed <text>, letters, digits, _ and - are allowed."
+		if seed := b.seeds.Get(strconv.FormatInt(chatID, 10)); seed != "" {
+			reply += fmt.Sprintf("\nYour seed: `%s`", seed)
+		}
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return
+	}
+	if len(args) != 1 || !playerSeedFormat.MatchString(args[0]) {
+		reply = "Seed must be up to 64 letters, digits, _ and -, e.g. /seed lucky-42"
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return
+	}
+
+	if err := b.seeds.Put(strconv.FormatInt(chatID, 10), args[0]); err != nil {
+		Error.Printf("Can't save seed of the user:\n\tChatID: %d\n\t%s", chatID, err)
+		reply = "Something went wrong, please try again."
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return
+	}
+	reply = fmt.Sprintf("Your seed is set to `%s`, it's used from the next game you play.", args[0])
+	replyTo(chatID, reply, b.transport, mainKeyboard)
+}
+
+// Withdraw sends balance of the user to its wallet address.
+func (b *Bot) Withdraw(chatID int64) {
+	reply := ""
+
+	if !b.users.Exist(chatID) || !b.users.Get(chatID).GetSubscribed() {
+		needToBeSubscribed(chatID, b.transport)
+		return
+	}
+
+	user := b.users.Get(chatID)
+	if user.GetWalletAddress() == "" {
+		reply = "You have no wallet address, set it up first by /changewalletaddress."
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return
+	}
+	if user.GetBalance() < b.opts.minWithdrawal {
+		reply = fmt.Sprintf("Minimum amount to withdraw is *%f BCH*, your balance is *%f BCH*.",
+			b.opts.minWithdrawal, user.GetBalance())
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		return
+	}
+
+	entry, err := b.withdraw(user)
+	if err != nil {
+		Error.Printf("Can't withdraw balance of the user:\n\tChatID: %d\n\t%s", chatID, err)
+		reply = "Something went wrong, please try again later."
+	} else if entry.Status == PayoutSent {
+		reply = fmt.Sprintf("*%f BCH* sent to your wallet \U0001f4b6 Transaction: `%s`",
+			entry.Amount, entry.TxID)
+	} else {
+		reply = fmt.Sprintf("*%f BCH* couldn't be sent right now, "+
+			"it will be sent automatically a bit later.", entry.Amount)
+	}
+	replyTo(chatID, reply, b.transport, mainKeyboard)
+}
+
+func formHistoryEntry(game *GameRecord, uid int64) string {
+	entry := fmt.Sprintf("\U0001f3ae *Game #%d* %s\n",
+		game.GameID, game.StartTime.Format(time.RFC1123))
+	reached := 0
+
+	for _, r := range game.Rounds {
+		for _, m := range r.Matches {
+			if m.PlayerA != uid && m.PlayerB != uid {
+				continue
+			}
+			reached = r.Number
+
+			opponent := m.PlayerB
+			if m.PlayerB == uid {
+				opponent = m.PlayerA
+			}
+			if opponent == -1 {
+				entry += fmt.Sprintf("Round %d: no opponent, passed to the next round\n", r.Number)
+				continue
+			}
+
+			result := "lost"
+			if m.Winner == uid {
+				result = "won"
+			}
+			if m.CoinFlip {
+				result += " by coin flip"
+			}
+			throws := []string{}
+			for _, t := range m.ThrowList() {
+				move, opponentMove, auto, opponentAuto := t.MoveA, t.MoveB, t.AutoA, t.AutoB
+				if m.PlayerB == uid {
+					move, opponentMove, auto, opponentAuto = t.MoveB, t.MoveA, t.AutoB, t.AutoA
+				}
+				throws = append(throws, fmt.Sprintf("*%s*%s - *%s*%s",
+					move, autoMark(auto), opponentMove, autoMark(opponentAuto)))
+			}
+			entry += fmt.Sprintf("Round %d vs _%s_: %s, %s\n",
+				r.Number, game.ParticipantName(opponent), strings.Join(throws, ", "), result)
+		}
+	}
+
+	entry += fmt.Sprintf("Round reached: *%d* of *%d*", reached, len(game.Rounds))
+	if game.Winner == uid {
+		entry += " \U0001f3c6"
+	}
+	entry += fmt.Sprintf("\nWon amount: *%f BCH*\n", game.WonAmount(uid))
+
+	return entry
+}
+
+func autoMark(auto bool) string {
+	if auto {
+		return " (auto)"
+	}
+
+	return ""
+}
+
 // ChangeName updates username of user.
-func (b *Bot) ChangeName(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
+func (b *Bot) ChangeName(chatID int64) {
 	reply := ""
-	chatID := update.Message.Chat.ID
 	replyError := func() {
 		reply = "Something went wrong, please try again."
-		replyTo(chatID, reply, botAPI, mainKeyboard)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
 	}
 
 	if b.users.Exist(chatID) && b.users.Get(chatID).GetSubscribed() {
 		if clientModifyChannels.Exist(chatID) {
 			reply = "You're already in process of modifying your data. You can reset it by /reset."
-			replyTo(chatID, reply, botAPI, mainKeyboard)
+			replyTo(chatID, reply, b.transport, mainKeyboard)
 			return
 		}
 		user := b.users.Get(chatID)
 		reply = "Enter new username please."
-		replyTo(chatID, reply, botAPI, mainKeyboard)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
 
 		ch := make(chan string)
 		clientModifyChannels.Put(chatID, ch)
@@ -434,27 +813,22 @@ func (b *Bot) ChangeName(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
 		name := watchClientModify(chatID, &clientModifyChannels, b.opts)
 		if name == "" {
 			reply = "Request is expired or reset."
-			replyTo(chatID, reply, botAPI, mainKeyboard)
+			replyTo(chatID, reply, b.transport, mainKeyboard)
 			return
 		}
 		if NameValidate(name) && !b.names.Exist(name) {
 			oldName := user.GetName()
 			user.SetName(name)
-			if err := b.names.Delete(oldName); err != nil {
-				Error.Printf("Can't delete old name:\n\tChatID: %d\n\tName: %s",
-					chatID, name)
-				replyError()
-				return
-			}
-			if err := b.users.Put(chatID, user); err != nil {
-				Error.Printf("Can't save user with new name:\n\tChatID: %d\n\tName: %s",
-					chatID, name)
-				replyError()
-				return
-			}
-			if err := b.names.Put(name, ""); err != nil {
-				Error.Printf("Can't save new name:\n\tChatID: %d\n\tName: %s",
-					chatID, name)
+			err := b.storage.Update(func(tx *Tx) error {
+				b.names.TxDelete(tx, oldName)
+				b.names.TxPut(tx, name, "")
+				b.users.TxPut(tx, chatID, user)
+				return nil
+			})
+			if err != nil {
+				user.SetName(oldName)
+				Error.Printf("Can't save user with new name:\n\tChatID: %d\n\tName: %s\n\t%s",
+					chatID, name, err)
 				replyError()
 				return
 			}
@@ -462,26 +836,25 @@ func (b *Bot) ChangeName(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
 		} else {
 			reply = "This username isn't valid or occupied by someone else, try to change something."
 		}
-		replyTo(chatID, reply, botAPI, mainKeyboard)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
 	} else {
-		needToBeSubscribed(chatID, botAPI)
+		needToBeSubscribed(chatID, b.transport)
 	}
 }
 
 // ChangeWalletAddress updates wallet address of user.
-func (b *Bot) ChangeWalletAddress(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
+func (b *Bot) ChangeWalletAddress(chatID int64) {
 	reply := ""
-	chatID := update.Message.Chat.ID
 
 	if b.users.Exist(chatID) && b.users.Get(chatID).GetSubscribed() {
 		if clientModifyChannels.Exist(chatID) {
 			reply = "You're already in process of modifying your data. You can reset it by /reset."
-			replyTo(chatID, reply, botAPI, mainKeyboard)
+			replyTo(chatID, reply, b.transport, mainKeyboard)
 			return
 		}
 		user := b.users.Get(chatID)
 		reply = "Enter new wallet address please."
-		replyTo(chatID, reply, botAPI, mainKeyboard)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
 
 		ch := make(chan string)
 		clientModifyChannels.Put(chatID, ch)
@@ -489,20 +862,27 @@ func (b *Bot) ChangeWalletAddress(update tgbotapi.Update, botAPI *tgbotapi.BotAP
 		wallet := watchClientModify(chatID, &clientModifyChannels, b.opts)
 		if wallet == "" {
 			reply = "Request is expired or reset."
-			replyTo(chatID, reply, botAPI, mainKeyboard)
+			replyTo(chatID, reply, b.transport, mainKeyboard)
 			return
 		}
 		if WalletValidate(wallet) {
 			user.SetWalletAddress(wallet)
 			b.users.Put(chatID, user)
 			reply = "Wallet set successfully!"
+			if user.GetBalance() >= b.opts.minWithdrawal {
+				if entry, err := b.withdraw(user); err != nil {
+					Error.Printf("Can't withdraw balance of the user:\n\tChatID: %d\n\t%s", chatID, err)
+				} else {
+					reply += fmt.Sprintf(" Your balance of *%f BCH* is sent to it.", entry.Amount)
+				}
+			}
 		} else {
 			reply = "This wallet isn't valid, try to change something. " +
 				"Note that you need to input in a cash address format, not a legacy one."
 		}
-		replyTo(chatID, reply, botAPI, mainKeyboard)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
 	} else {
-		needToBeSubscribed(chatID, botAPI)
+		needToBeSubscribed(chatID, b.transport)
 	}
 }
 
@@ -516,43 +896,41 @@ func (b *Bot) ChangeWalletAddress(update tgbotapi.Update, botAPI *tgbotapi.BotAP
 
 // YesUnsubscribe confirms unsubscribe action.
 // Appear only when user has ticket.
-func (b *Bot) YesUnsubscribe(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
-	var chatID int64
+func (b *Bot) YesUnsubscribe(chatID int64) {
 	reply := "You're now unsubscribed."
 
-	if update.CallbackQuery != nil {
-		chatID = update.CallbackQuery.Message.Chat.ID
-	} else {
-		chatID = update.Message.Chat.ID
-	}
-
 	if !b.users.Exist(chatID) || b.users.Exist(chatID) && !b.users.Get(chatID).GetSubscribed() {
 		reply = "You're not subscribed."
-		replyTo(chatID, reply, botAPI, mainKeyboard)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
 		return
 	}
 	user := b.users.Get(chatID)
+	tickets := user.GetTickets()
 	user.SetSubscribed(false)
-	user.SetHasTicket(false)
-	if err := b.users.Put(chatID, user); err != nil {
+	user.SetTickets([]Ticket{})
+	err := b.storage.Update(func(tx *Tx) error {
+		b.users.TxPut(tx, chatID, user)
+		b.queue.TxRemove(tx, tickets...)
+		return nil
+	})
+	if err != nil {
 		Error.Printf("Can't unsubscribe:\n\tChatID: %d\n\t%s",
 			chatID, err)
 		reply = "Something went wrong, pleaase try again."
 	}
 
-	replyTo(chatID, reply, botAPI, mainKeyboard)
+	replyTo(chatID, reply, b.transport, mainKeyboard)
 }
 
 // NoUnsubscribe dismiss unsubscribe action.
-func (b *Bot) NoUnsubscribe(update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
-	chatID := update.CallbackQuery.Message.Chat.ID
+func (b *Bot) NoUnsubscribe(chatID int64) {
 	reply := "You won't be unsubscribed."
 
 	if !b.users.Exist(chatID) || b.users.Exist(chatID) && !b.users.Get(chatID).GetSubscribed() {
 		reply = "You're not subscribed."
 	}
 
-	replyTo(chatID, reply, botAPI, mainKeyboard)
+	replyTo(chatID, reply, b.transport, mainKeyboard)
 }
 
 ////////////****************************************************////////////
@@ -567,7 +945,6 @@ func (b *Bot) cleanupProcessBuyTicket(
 	chatID int64,
 	requestID string,
 	channels *SynMap,
-	botAPI *tgbotapi.BotAPI,
 ) {
 	Verbose.Printf("Cleaning up request for:\n\tChatID: %d\n\tRequestID: %s",
 		chatID, requestID)
@@ -576,7 +953,7 @@ func (b *Bot) cleanupProcessBuyTicket(
 		Warning.Printf("Can't unregister request:\n\tChatID: %d\n\t%s", chatID, err)
 	}
 
-	if err := RemoveRequest(requestID, b.opts.cashboxWalletPath, b.opts.testnet); err != nil {
+	if err := b.cashbox.RemoveRequest(requestID); err != nil {
 		Error.Printf("Can't remove request:\n\tRequestID: %s\n\t%s", requestID, err)
 	}
 }
@@ -584,19 +961,18 @@ func (b *Bot) cleanupProcessBuyTicket(
 func (b *Bot) processBuyTicket(
 	chatID int64,
 	channels *SynMap,
-	botAPI *tgbotapi.BotAPI,
 ) {
 	var paymentStatus uint8
 	reply := ""
-	requestID := b.requests.Get(strconv.FormatInt(chatID, 10))
+	requestID, count := parseRequest(b.requests.Get(strconv.FormatInt(chatID, 10)))
 
-	paymentStatus, err := b.processRequest(chatID, requestID, channels, botAPI)
+	paymentStatus, err := b.processRequest(chatID, requestID, channels)
 	if err != nil {
 		Error.Printf("Request can't be processed:\n\tChatID: %d\n\tRequestID: %s\n\t%s",
 			chatID, requestID, err)
 		reply = "Can't process your request, please try again."
-		replyTo(chatID, reply, botAPI, mainKeyboard)
-		b.cleanupProcessBuyTicket(chatID, requestID, channels, botAPI)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		b.cleanupProcessBuyTicket(chatID, requestID, channels)
 		return
 	}
 	if paymentStatus == 0 {
@@ -604,35 +980,53 @@ func (b *Bot) processBuyTicket(
 			chatID, requestID)
 
 		user := b.users.Get(chatID)
-		user.SetHasTicket(true)
-		user.SetLastTicketDate(time.Now())
-		if err := b.users.Put(chatID, user); err != nil {
-			Error.Printf("Can't give a ticket to the player:\n\tChatID: %d\n\tRequestID: %s",
-				chatID, requestID)
+		if err := b.giveTickets(user, newTickets(count, false, b.opts)); err != nil {
+			Error.Printf("Can't give a ticket to the player. CRITICAL.\n\tChatID: %d\n\tRequestID: %s\n\t%s",
+				chatID, requestID, err)
 		}
 
-		reply = "You've got a ticket \U0001f39f To check current game schedule type /status."
-		replyTo(chatID, reply, botAPI, mainKeyboard)
-		b.cleanupProcessBuyTicket(chatID, requestID, channels, botAPI)
+		reply = fmt.Sprintf("You've got *%d* tickets \U0001f39f To check current game schedule type /status.",
+			count)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		b.cleanupProcessBuyTicket(chatID, requestID, channels)
 	} else if paymentStatus == 1 {
 		Verbose.Printf("Time is up for:\n\tChatID: %d\n\tRequestID: %s",
 			chatID, requestID)
 		reply = "Time is up, would you like to try to /buyticket again?"
-		replyTo(chatID, reply, botAPI, mainKeyboard)
-		b.cleanupProcessBuyTicket(chatID, requestID, channels, botAPI)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+		b.cleanupProcessBuyTicket(chatID, requestID, channels)
 	} else {
 		Verbose.Printf("Transaction has been reset:\n\tChatID: %d\n\tequestID:%s",
 			chatID, requestID)
 	}
 }
 
+// parseRequest returns address of the payment request and number of tickets it pays for.
+// Requests stored without number of tickets pay for a single one.
+func parseRequest(value string) (string, int) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return "", 0
+	}
+	if len(fields) == 1 {
+		return fields[0], 1
+	}
+	count, err := strconv.Atoi(fields[1])
+	if err != nil {
+		count = 1
+	}
+
+	return fields[0], count
+}
+
 func registerRequest(
 	chatID int64,
 	address string,
-	requests *LDBMap,
+	count int,
+	requests KVStore,
 	channels *SynMap,
 ) error {
-	err := requests.Put(strconv.FormatInt(chatID, 10), address)
+	err := requests.Put(strconv.FormatInt(chatID, 10), fmt.Sprintf("%s %d", address, count))
 	if err != nil {
 		return err
 	}
@@ -644,7 +1038,7 @@ func registerRequest(
 
 func unregisterRequest(
 	chatID int64,
-	requests *LDBMap,
+	requests KVStore,
 	channels *SynMap,
 ) error {
 	if err := requests.Delete(strconv.FormatInt(chatID, 10)); err != nil {
@@ -664,7 +1058,6 @@ func (b *Bot) processRequest(
 	chatID int64,
 	requestID string,
 	channels *SynMap,
-	botAPI *tgbotapi.BotAPI,
 ) (uint8, error) {
 	paymentStatus, err := b.watchTransaction(chatID,
 		"status", "Paid", channels,
@@ -692,7 +1085,7 @@ func (b *Bot) watchTransaction(
 ) (uint8, error) {
 	var requestField interface{}
 	var i uint
-	requestID := b.requests.Get(strconv.FormatInt(chatID, 10))
+	requestID, _ := parseRequest(b.requests.Get(strconv.FormatInt(chatID, 10)))
 	ch := channels.Get(chatID).(chan bool)
 
 	Verbose.Printf("Watching for request:\n\tChatID: %d\n\tRequestID: %s",
@@ -707,7 +1100,7 @@ func (b *Bot) watchTransaction(
 				return 2, nil
 			}
 		default:
-			request, err := GetRequest(requestID, b.opts.cashboxWalletPath, b.opts.testnet)
+			request, err := b.cashbox.GetRequest(requestID)
 			if err != nil {
 				Error.Printf("Can't get request:\n\tRequestID: %s\n\t%s", requestID, err)
 				return 1, err
@@ -741,33 +1134,31 @@ func (b *Bot) watchTransaction(
 ////////////****************************************************////////////
 
 func formLeaderboard(users *Users) []*User {
-	totalWonAmountLST := users.FormTotalWonAmountList()
-	leaderboard := make([]*User, len(totalWonAmountLST))
-	for i := len(totalWonAmountLST) - 1; i >= 0; i-- {
-		leaderboard[len(totalWonAmountLST)-i-1] = totalWonAmountLST[i]
-		totalWonAmountLST[i].SetLeaderboardPosition(uint32(len(totalWonAmountLST) - i))
-		users.BatchPut(totalWonAmountLST[i].GetUserID(), totalWonAmountLST[i])
-	}
-	if err := users.BatchWrite(); err != nil {
-		Error.Printf("Can't update leaderboard positions.")
+	return users.UpdateLeaderboard(leaderboardSize)
+}
+
+// alignPlayers cuts players exceeding capacity of the game.
+// Any number of players can play, byes fill up the bracket.
+func alignPlayers(players []int64, opts *Options) ([]int64, []int64) {
+	if uint(len(players)) <= opts.capacity {
+		return players, []int64{}
 	}
 
-	return leaderboard
+	return players[:opts.capacity], players[opts.capacity:]
 }
 
-func alignPlayers(players []int64, opts *Options) ([]int64, []int64) {
-	var c uint = 2
-	for c < opts.capacity {
-		if c > uint(len(players)) {
-			return players[:c>>1], players[c>>1:]
-		}
+// byesCount returns number of players passing the round without a match,
+// so the number of players of the next round is a power of two.
+func byesCount(players int) int {
+	c := 1
+	for c < players {
 		c = c << 1
 	}
 
-	return players[:opts.capacity], players[opts.capacity:]
+	return c - players
 }
 
-func transitionToReady(stats *LDBMap) error {
+func transitionToReady(stats KVStore) error {
 	if err := stats.Put("ready", "true"); err != nil {
 		return err
 	}
@@ -775,7 +1166,7 @@ func transitionToReady(stats *LDBMap) error {
 	return nil
 }
 
-func transitionToGame(stats *LDBMap) error {
+func transitionToGame(stats KVStore) error {
 	if err := stats.Put("ready", "false"); err != nil {
 		return err
 	}
@@ -786,16 +1177,373 @@ func transitionToGame(stats *LDBMap) error {
 	return nil
 }
 
+// startGameRecord creates and saves record of the game of current players.
+// The jackpot is moved to the pot of the game and the house fee is paid, unless the game
+// is restored, since they were taken when the game started.
+// The record is kept in memory even if it can't be saved.
+func (b *Bot) startGameRecord(restored bool) error {
+	gameID, err := nextCounter(b.stats, "lastGameID")
+	ticketsAmount := float64(len(b.players)) * b.opts.ticketPrice
+	fee := houseFee(len(b.players), b.opts)
+	jackpot := 0.0
+	if !restored {
+		jackpot = getJackpot(b.stats)
+	}
+	record := NewGameRecord(gameID, b.opts, ticketsAmount, fee, jackpot, b.players, b.users)
+	// Keep the record in memory anyway, so the game is recorded as far as possible
+	b.game = &record
+	record.ServerSeed, record.ClientSeed = b.stats.Get("nextServerSeed"), clientSeed(gameID, b.players, b.seeds)
+	// Hash of a seed made just now was never published, so the game can't be proven fair by it
+	if record.ServerSeed == "" && err == nil {
+		err = errors.New("hash of the server seed isn't published")
+	}
+	record.ServerSeedHash = hashSeed(record.ServerSeed)
+	nextSeed, seedErr := newSeed()
+	if err == nil {
+		err = seedErr
+	}
+	if err == nil {
+		err = b.storage.Update(func(tx *Tx) error {
+			if err := b.games.TxPut(tx, &record); err != nil {
+				return err
+			}
+			b.stats.TxPut(tx, "nextServerSeed", nextSeed)
+			if !restored {
+				txPutJackpot(tx, b.stats, 0)
+			}
+			b.stats.TxPut(tx, "currentGame", strconv.FormatUint(gameID, 10))
+			return nil
+		})
+	}
+	if err != nil {
+		// The jackpot is still there, so it's played next time, and the fee isn't paid, so it's left in the pot
+		if !restored {
+			record.Pot, record.Fee, record.Jackpot = ticketsAmount, 0, 0
+		}
+		return err
+	}
+	if !restored {
+		b.payFee()
+	}
+
+	return nil
+}
+
+// restoreGameRecord loads record of the interrupted game or starts a new one if it's lost.
+// Pot, jackpot and fee of the game are taken from its record, they aren't taken again.
+func (b *Bot) restoreGameRecord() error {
+	if gameID, err := strconv.ParseUint(b.stats.Get("currentGame"), 10, 64); err == nil {
+		// Finished record is kept, so its game isn't played again
+		if record, err := b.games.Get(gameID); err == nil {
+			b.game = &record
+			// Records made before the pot was kept
+			if b.game.Pot == 0 {
+				b.game.TicketsAmount = float64(len(b.game.Participants)) * b.opts.ticketPrice
+				b.game.Pot = b.game.TicketsAmount
+			}
+			return nil
+		}
+	}
+
+	return b.startGameRecord(true)
+}
+
+// nextSeedHash returns hash of the server seed of the next game.
+// The seed is made in advance, so it's fixed before players of the game are known.
+func (b *Bot) nextSeedHash() string {
+	seed := b.stats.Get("nextServerSeed")
+	if seed == "" {
+		var err error
+		if seed, err = newSeed(); err != nil {
+			Error.Printf("Can't make server seed of the next game\n\t%s", err)
+			return ""
+		}
+		if err := b.stats.Put("nextServerSeed", seed); err != nil {
+			Error.Printf("Can't save server seed of the next game\n\t%s", err)
+			return ""
+		}
+	}
+
+	return hashSeed(seed)
+}
+
+// finishGameRecord ends the game and rolls the unpaid rest of the pot over to the jackpot.
+func (b *Bot) finishGameRecord() {
+	b.game.EndTime = time.Now()
+	b.game.RolledOver = clampPrize(b.game.Unpaid(), b.game.Pot, b.game.Paid())
+	jackpot := getJackpot(b.stats) + b.game.RolledOver
+	err := b.storage.Update(func(tx *Tx) error {
+		if err := b.games.TxPut(tx, b.game); err != nil {
+			return err
+		}
+		txPutJackpot(tx, b.stats, jackpot)
+		return nil
+	})
+	if err != nil {
+		Error.Printf("Can't finish record of the game\n\tGameID: %d\n\tRolledOver: %f\n\t%s",
+			b.game.GameID, b.game.RolledOver, err)
+		return
+	}
+	Info.Printf("Game is over\n\tGameID: %d\n\tPot: %f\n\tRolledOver: %f\n\tJackpot: %f",
+		b.game.GameID, b.game.Pot, b.game.RolledOver, jackpot)
+
+	ids := []int64{}
+	for _, p := range b.game.Participants {
+		ids = append(ids, p.UserID)
+	}
+	reply := fmt.Sprintf("Game #%d is over, its server seed is revealed: `%s`\n"+
+		"Use /verify %d to check the results.", b.game.GameID, b.game.ServerSeed, b.game.GameID)
+	replyToMany(ids, reply, b.transport, mainKeyboard)
+}
+
+// saveGameRecord saves current state of the game record.
+func (b *Bot) saveGameRecord() {
+	if err := b.games.Put(b.game); err != nil {
+		Error.Printf("Can't save record of the game\n\tGameID: %d\n\t%s", b.game.GameID, err)
+	}
+}
+
+// payToUser pays to the user from the bank through the ledger
+// and adds the payout to the game record.
+// Payouts of users without wallet address are credited to their balance.
+func (b *Bot) payToUser(user *User, amount float64) {
+	entry := LedgerEntry{GameID: b.game.GameID, UserID: user.GetUserID(),
+		Address: user.GetWalletAddress(), Amount: amount, Status: PayoutPending}
+	if entry.Address == "" {
+		entry.Status = PayoutCredited
+	}
+	if err := b.ledger.Add(&entry); err != nil {
+		Error.Printf("Can't add payout to the ledger:\n\tUserID: %d\n\tAmount: %f\n\t%s",
+			entry.UserID, entry.Amount, err)
+	}
+	if entry.Status == PayoutPending {
+		b.sendPayout(&entry)
+	} else {
+		b.credit(user, amount)
+	}
+
+	b.game.Payouts = append(b.game.Payouts, PayoutRecord{entry.UserID, entry.Address,
+		entry.Amount, entry.TxID, entry.Error, time.Now(), entry.ID})
+}
+
+// payFee sends the house fee of the game to the operator through the ledger.
+func (b *Bot) payFee() {
+	if b.game.Fee <= 0 {
+		return
+	}
+
+	entry := LedgerEntry{GameID: b.game.GameID, Address: b.opts.operatorAddress,
+		Amount: b.game.Fee, Status: PayoutPending}
+	if err := b.ledger.Add(&entry); err != nil {
+		Error.Printf("Can't add house fee to the ledger:\n\tGameID: %d\n\tAmount: %f\n\t%s",
+			entry.GameID, entry.Amount, err)
+	}
+	b.sendPayout(&entry)
+}
+
+// sendPayout sends the payout claimed in the ledger and records the outcome.
+func (b *Bot) sendPayout(entry *LedgerEntry) {
+	entry.Attempts++
+	txID, err := b.bank.PayTo(entry.Address, entry.Amount)
+	if err != nil {
+		entry.Status, entry.Error = PayoutFailed, err.Error()
+		entry.NextAttempt = time.Now().Add(payoutBackoff(entry.Attempts))
+		Error.Printf("Couldn't pay to user:\n\tUserID: %d\n\tAmount: %f\n\tAttempt: %d\n\t%s",
+			entry.UserID, entry.Amount, entry.Attempts, err)
+	} else {
+		entry.Status, entry.TxID, entry.Error = PayoutSent, txID, ""
+		Info.Printf("Payout sent:\n\tUserID: %d\n\tAmount: %f\n\tTxID: %s",
+			entry.UserID, entry.Amount, txID)
+	}
+
+	if err := b.ledger.Put(entry); err != nil {
+		Error.Printf("Can't update payout in the ledger:\n\tID: %d\n\tStatus: %s\n\t%s",
+			entry.ID, entry.Status, err)
+	}
+}
+
+// credit adds the amount to the balance of the user.
+func (b *Bot) credit(user *User, amount float64) {
+	balance := user.AddBalance(amount)
+	if err := b.users.Put(user.GetUserID(), user); err != nil {
+		Error.Printf("Can't credit the balance of the user:\n\tUserID: %d\n\tAmount: %f\n\t%s",
+			user.GetUserID(), amount, err)
+		return
+	}
+	Info.Printf("Balance credited:\n\tUserID: %d\n\tAmount: %f\n\tBalance: %f",
+		user.GetUserID(), amount, balance)
+}
+
+// creditOwed moves payouts held in the ledger as owed to the balances of their users.
+func (b *Bot) creditOwed() {
+	for _, entry := range b.ledger.Claim(func(e *LedgerEntry) bool { return e.Status == PayoutOwed }) {
+		if !b.users.Exist(entry.UserID) {
+			continue
+		}
+		b.credit(b.users.Get(entry.UserID), entry.Amount)
+		entry.Status = PayoutCredited
+		if err := b.ledger.Put(&entry); err != nil {
+			Error.Printf("Can't update payout in the ledger:\n\tID: %d\n\tStatus: %s\n\t%s",
+				entry.ID, entry.Status, err)
+		}
+	}
+}
+
+// withdraw sends the whole balance of the user to its wallet address through the ledger.
+// Failed withdrawal is retried as any other payout.
+func (b *Bot) withdraw(user *User) (LedgerEntry, error) {
+	amount := user.GetBalance()
+	entry := LedgerEntry{UserID: user.GetUserID(), Address: user.GetWalletAddress(),
+		Amount: amount, Status: PayoutPending}
+
+	// Balance may be taken by a concurrent withdrawal or purchase since it was read
+	if amount <= 0 || !user.Debit(amount) {
+		return entry, errors.New("balance is changed while withdrawing")
+	}
+	if err := b.users.Put(user.GetUserID(), user); err != nil {
+		user.AddBalance(amount)
+		return entry, err
+	}
+	if err := b.ledger.Add(&entry); err != nil {
+		user.AddBalance(amount)
+		b.users.Put(user.GetUserID(), user)
+		return entry, err
+	}
+	b.sendPayout(&entry)
+
+	return entry, nil
+}
+
+// retryPayouts periodically resends failed payouts whose backoff is over.
+func (b *Bot) retryPayouts() {
+	for now := range time.Tick(payoutRetryInterval) {
+		b.retryDuePayouts(now)
+	}
+}
+
+// retryDuePayouts resends failed payouts whose backoff is over by now.
+func (b *Bot) retryDuePayouts(now time.Time) {
+	for _, entry := range b.ledger.Claim(func(e *LedgerEntry) bool {
+		return e.Status == PayoutFailed && !e.NextAttempt.After(now)
+	}) {
+		b.sendPayout(&entry)
+	}
+}
+
+// moveToBank moves the amount from the cashbox to the bank.
+func (b *Bot) moveToBank(amount float64) error {
+	address, _, err := b.bank.CreateRequest(1)
+	if err != nil {
+		return err
+	}
+	Info.Printf("Request to move funds to the bank created successfully.")
+	if _, err := b.cashbox.PayTo(address, amount); err != nil {
+		return err
+	}
+	Info.Printf("Funds have been moved to the bank successfully.")
+	if err := b.bank.ClearRequests(); err != nil {
+		Warning.Printf("Can't clear requests of the bank wallet:\n\t%s", err)
+	} else {
+		Verbose.Printf("Requests of the bank wallet cleared successfully.")
+	}
+
+	return nil
+}
+
+// expireTickets returns price of expired tickets to the balances of their owners.
+// Returns number of expired tickets paid on-chain.
+func (b *Bot) expireTickets() int {
+	onChain := 0
+	now := time.Now()
+
+	owners := []int64{}
+	for _, entry := range b.queue.List() {
+		if !entry.Expires.IsZero() && now.After(entry.Expires) &&
+			ContainsInt64(entry.UserID, owners) == -1 {
+			owners = append(owners, entry.UserID)
+		}
+	}
+
+	for _, chatID := range owners {
+		user := b.users.Get(chatID)
+		old := user.GetTickets()
+		expired := user.TakeExpiredTickets(now)
+		amount := float64(len(expired)) * b.opts.ticketPrice
+		balance := user.AddBalance(amount)
+		err := b.storage.Update(func(tx *Tx) error {
+			b.users.TxPut(tx, chatID, user)
+			b.queue.TxRemove(tx, expired...)
+			return nil
+		})
+		if err != nil {
+			Error.Printf("Can't expire tickets:\n\tChatID: %d\n\t%s", chatID, err)
+			user.AddBalance(-amount)
+			user.SetTickets(old)
+			continue
+		}
+		for _, ticket := range expired {
+			if !ticket.FromBalance {
+				onChain++
+			}
+		}
+
+		Info.Printf("Tickets expired:\n\tChatID: %d\n\tCount: %d\n\tBalance: %f",
+			chatID, len(expired), balance)
+		reply := fmt.Sprintf("*%d* of your tickets expired, *%f BCH* returned to your balance.",
+			len(expired), amount)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
+	}
+
+	return onChain
+}
+
+// queueLegacyTickets puts tickets bought before the queue was introduced into the queue.
+func (b *Bot) queueLegacyTickets() {
+	for _, user := range b.users.TicketHolders() {
+		tickets := user.GetTickets()
+		legacy := []Ticket{}
+		for _, ticket := range tickets {
+			if ticket.ID == 0 {
+				legacy = append(legacy, ticket)
+			}
+		}
+		if len(legacy) == 0 {
+			continue
+		}
+
+		if err := b.queue.AssignIDs(legacy); err != nil {
+			Error.Printf("Can't queue tickets:\n\tChatID: %d\n\t%s", user.GetUserID(), err)
+			continue
+		}
+		for i, j := 0, 0; i < len(tickets); i++ {
+			if tickets[i].ID == 0 {
+				tickets[i] = legacy[j]
+				j++
+			}
+		}
+		user.SetTickets(tickets)
+		err := b.storage.Update(func(tx *Tx) error {
+			b.users.TxPut(tx, user.GetUserID(), user)
+			b.queue.TxPush(tx, user.GetUserID(), legacy...)
+			return nil
+		})
+		if err != nil {
+			Error.Printf("Can't queue tickets:\n\tChatID: %d\n\t%s", user.GetUserID(), err)
+		}
+	}
+}
+
 // GamePrepare takes all necessary actions to prepare the game.
-// Sort users by last ticket purchase date and align to ^2 number.
-func (b *Bot) GamePrepare(botAPI *tgbotapi.BotAPI) {
+// Players are seated from the ticket queue in order of purchase,
+// tickets of the overflow keep their places for the next game.
+// Number of players is limited by capacity of the game.
+func (b *Bot) GamePrepare() {
 	reply := ""
-	lastTicketDateSorted := b.users.FormLastTicketDateList()
 	replyCritical := func() {
 		reply = "Due the critical error game couldn't start this time, please " +
-			"accept our apologies and wait for the next round." +
-			"Your funds are probably safe and sound \U0001f642"
-		replyToMany(b.players, reply, botAPI, mainKeyboard)
+			"accept our apologies and wait for the next round. " +
+			"Your tickets keep their place in the queue \U0001f642"
+		replyToMany(b.players, reply, b.transport, mainKeyboard)
 	}
 
 	if err := b.stats.Put("prepare", "true"); err != nil {
@@ -804,131 +1552,199 @@ func (b *Bot) GamePrepare(botAPI *tgbotapi.BotAPI) {
 		return
 	}
 
-	if b.stats.Get("ready") == "false" {
-		for _, user := range lastTicketDateSorted {
-			if user.GetHasTicket() == true {
-				userID := user.GetUserID()
-				b.players = append(b.players, userID)
+	// Stats of a new database have no stage yet, so it's prepared as well
+	if b.stats.Get("ready") != "true" {
+		// The game is played by the seed which hash is published in advance,
+		// so it's postponed until the next time if there is none yet
+		if b.stats.Get("nextServerSeed") == "" {
+			hash := b.nextSeedHash()
+			Warning.Printf("Server seed of the game wasn't published, game won't start.")
+			reply = fmt.Sprintf("Seed hash of the next game is published only now: `%s`\n"+
+				"The game is postponed until the next time, your tickets keep their place in the queue.", hash)
+			replyToMany(b.queue.Players(), reply, b.transport, mainKeyboard)
+			return
+		}
+
+		// Money of expired tickets paid on-chain is still in the cashbox
+		onChain := b.expireTickets()
+
+		for _, chatID := range b.queue.Players() {
+			if !b.users.Exist(chatID) || !b.users.Get(chatID).GetHasTicket() {
+				Warning.Printf("Queued ticket of the user without tickets:\n\tChatID: %d", chatID)
+				continue
 			}
+			b.players = append(b.players, chatID)
 		}
 
 		if len(b.players) < 2 {
 			Info.Printf("Not enough players, game won't start.")
 			reply = "There is not enough players, can't start the game for now."
-			replyToMany(b.players, reply, botAPI, mainKeyboard)
+			replyToMany(b.players, reply, b.transport, mainKeyboard)
 			b.players = []int64{}
+			if onChain > 0 {
+				if err := b.moveToBank(float64(onChain) * b.opts.ticketPrice); err != nil {
+					Error.Printf("Can't move money of expired tickets to the bank. CRITICAL.\n\t%s", err)
+				}
+			}
 			return
 		}
 
 		tail := []int64{}
 		b.players, tail = alignPlayers(b.players, b.opts)
+		taken := map[int64]Ticket{}
 		for _, chatID := range b.players {
 			user := b.users.Get(chatID)
+			ticket, _ := user.TakeTicket()
+			taken[chatID] = ticket
+			// Tickets paid from the balance are in the bank already
+			if !ticket.FromBalance {
+				onChain++
+			}
 			user.SetIsPlayer(true)
-			user.SetPlaySequence("")
 			user.SetLastWonAmount(0)
-			b.users.BatchPut(chatID, user)
-			reply = fmt.Sprintf("Get ready, game is starting! This time %d players are taking a part.",
-				len(b.players))
-			replyTo(chatID, reply, botAPI, mainKeyboard)
-		}
-
-		reply = "Game is crowded for now, your ticket will play next round."
-		replyToMany(tail, reply, botAPI, mainKeyboard)
-
-		if err := b.users.BatchWrite(); err != nil {
-			Error.Printf("Can't prepare users to the game.")
-			replyToMany(b.players, reply, botAPI, mainKeyboard)
-			return
 		}
-
-		address, _, err := CreateRequest(1, b.opts.bankWalletPath, b.opts.testnet)
+		err := b.storage.Update(func(tx *Tx) error {
+			for chatID, ticket := range taken {
+				b.users.TxPut(tx, chatID, b.users.Get(chatID))
+				b.queue.TxRemove(tx, ticket)
+			}
+			return nil
+		})
 		if err != nil {
-			Error.Printf("Can't create request to move money to the bank. CRITICAL.\n\t%s", err)
+			Error.Printf("Can't prepare users to the game. CRITICAL.\n\t%s", err)
 			replyCritical()
+			b.returnTickets(taken, false)
 			return
 		}
-		Info.Printf("Request to move funds to the bank created successfully.")
-		move := -1.0
-		if len(tail) != 0 {
-			move = float64(len(b.players)) * b.opts.ticketPrice
+
+		// Cashbox keeps money of the tickets for the next games, so only used ones are moved
+		if onChain > 0 {
+			if err := b.moveToBank(float64(onChain) * b.opts.ticketPrice); err != nil {
+				Error.Printf("Can't move money to the bank. CRITICAL.\n\t%s", err)
+				replyCritical()
+				b.returnTickets(taken, false)
+				return
+			}
 		}
-		if err := PayTo(address, move, b.opts.cashboxWalletPath, b.opts.testnet); err != nil {
-			Error.Printf("Can't move money to the bank. CRITICAL.\n\t%s", err)
+
+		if err := b.startGameRecord(false); err != nil {
+			Error.Printf("Can't create record of the game\n\t%s", err)
+			b.game = nil
 			replyCritical()
+			b.returnTickets(taken, true)
 			return
 		}
-		Info.Printf("Funds have been moved to the bank successfully.")
-		if err := ClearRequests(b.opts.bankWalletPath, b.opts.testnet); err != nil {
-			Warning.Printf("Can't clear requests of the bank wallet:\n\t%s", err)
-		} else {
-			Verbose.Printf("Requests of the bank wallet cleared successfully.")
-		}
 
-		// Set ready status to true in case of server shutdown before the game start
+		reply = fmt.Sprintf("Get ready, game is starting! This time %d players are taking a part.",
+			len(b.players))
+		replyToMany(b.players, reply, b.transport, mainKeyboard)
+		reply = "Game is crowded for now, your ticket keeps its place in the queue for the next game."
+		replyToMany(tail, reply, b.transport, mainKeyboard)
+		reply = fmt.Sprintf("Game #%d is provably fair \U0001f510\nServer seed hash: `%s`\n"+
+			"Client seed: `%s`\nThe server seed is revealed when the game is over.",
+			b.game.GameID, b.game.ServerSeedHash, b.game.ClientSeed)
+		replyToMany(b.players, reply, b.transport, mainKeyboard)
+
+		// Set ready status to true in case of server shutdown before the game start.
+		// Tickets are in the pot of the game already, so it's played anyway
 		if err := transitionToReady(b.stats); err != nil {
 			Error.Printf("Can't make a transition to the prepare stage\n\t%s", err)
-			replyCritical()
-			return
 		}
 	}
 
 	// Wait 10 seconds before start the actual game
 	time.Sleep(10 * time.Second)
 
-	// Set game status to true in case of server shutdown before the game end
+	// Set game status to true in case of server shutdown before the game end.
+	// The game is paid already, so it's played anyway
 	if err := transitionToGame(b.stats); err != nil {
 		Error.Printf("Can't make a transition to the game stage\n\t%s", err)
-		replyCritical()
-		return
 	}
 
-	go b.Play(botAPI)
+	go b.Play()
 }
 
-// GameRestore resurects game if bot crashed.
-func (b *Bot) GameRestore(botAPI *tgbotapi.BotAPI) {
-	for uid, user := range b.users.Iterate() {
-		if user.GetIsPlayer() == true {
-			b.players = append(b.players, uid)
+// returnTickets gives the taken tickets back to the players of the game which couldn't start
+// and frees their seats. Tickets keep their place in the queue.
+// Money of the tickets moved to the bank stays there, so they're returned as paid from the balance.
+func (b *Bot) returnTickets(taken map[int64]Ticket, inBank bool) {
+	for chatID, ticket := range taken {
+		if inBank {
+			ticket.FromBalance = true
+			taken[chatID] = ticket
 		}
+		user := b.users.Get(chatID)
+		user.SetTickets(append([]Ticket{ticket}, user.GetTickets()...))
+		user.SetIsPlayer(false)
+	}
+	err := b.storage.Update(func(tx *Tx) error {
+		for chatID, ticket := range taken {
+			b.users.TxPut(tx, chatID, b.users.Get(chatID))
+			b.queue.TxPush(tx, chatID, ticket)
+		}
+		return nil
+	})
+	if err != nil {
+		Error.Printf("Can't return tickets of the players. CRITICAL.\n\t%s", err)
+	}
+	b.players = []int64{}
+}
+
+// GameRestore resurects game if bot crashed.
+func (b *Bot) GameRestore() {
+	for _, user := range b.users.Players() {
+		b.players = append(b.players, user.GetUserID())
 	}
 	tail := []int64{}
 	b.players, tail = alignPlayers(b.players, b.opts)
+	if err := b.restoreGameRecord(); err != nil {
+		Error.Printf("Can't restore record of the game\n\t%s", err)
+	}
+	// Game was over before the crash, its prizes are paid already
+	if b.game != nil && b.game.Finished() {
+		Info.Printf("Game is over already\n\tGameID: %d", b.game.GameID)
+		b.players = append(b.players, tail...)
+		b.GameReset()
+		return
+	}
 	reply := "Something wrong has happened, sorry for inconvenience. The game continues!"
-	replyToMany(b.players, reply, botAPI, gameKeyboard)
+	replyToMany(b.players, reply, b.transport, b.opts.rules.Keyboard())
 	for _, id := range tail {
 		userReset(id, b.users)
 		user := b.users.Get(id)
-		if err := PayToUser(user, user.GetLastWonAmount(), b.opts.bankWalletPath, b.opts.testnet); err != nil {
-			Error.Printf("Couldn't pay to user:\n\tUserID: %d\n\tUsername: %s\n\t%s",
-				user.GetUserID(), user.GetName(), err)
-		}
+		b.payToUser(user, user.GetLastWonAmount())
 		reply = fmt.Sprintf("Something wrong has happened, very sorry for inconvenience, "+
 			"but this game is ended for you \U0001f614 Won amount: *%f BCH* \U0001f4b6",
 			user.GetLastWonAmount())
-		replyTo(id, reply, botAPI, mainKeyboard)
+		replyTo(id, reply, b.transport, mainKeyboard)
 	}
 
 	reply = "Due the critical error game couldn't start this time, please " +
 		"accept our apologies and wait for the next round. Your funds are probably safe and sound \U0001f642"
 	if err := transitionToGame(b.stats); err != nil {
 		Error.Printf("Can't make a transition to the game\n\t%s", err)
-		replyToMany(b.players, reply, botAPI, mainKeyboard)
+		replyToMany(b.players, reply, b.transport, mainKeyboard)
 		return
 	}
 
-	go b.Play(botAPI)
+	go b.Play()
 }
 
 // GameReset resets all users to pregame state and cleans players list.
-func (b *Bot) GameReset(botAPI *tgbotapi.BotAPI) {
+func (b *Bot) GameReset() {
 	for _, chatID := range b.players {
 		userReset(chatID, b.users)
-		replyTo(chatID, "This round is over, thank you for the game!", botAPI, mainKeyboard)
+		replyTo(chatID, "This round is over, thank you for the game!", b.transport, mainKeyboard)
 	}
 
 	b.players = make([]int64, 0)
+	b.game = nil
+	if err := b.state.Reset(); err != nil {
+		Error.Printf("Can't reset state of the game\n\t%s", err)
+	}
+	if err := b.stats.Delete("currentGame"); err != nil {
+		Error.Printf("Can't unset current game\n\t%s", err)
+	}
 	if err := b.stats.Put("game", "false"); err != nil {
 		Error.Printf("Can't set game status to false\n\t%s", err)
 	} else {
@@ -939,8 +1755,6 @@ func (b *Bot) GameReset(botAPI *tgbotapi.BotAPI) {
 func userReset(id int64, users *Users) {
 	user := users.Get(id)
 	user.SetIsPlayer(false)
-	user.SetHasTicket(false)
-	user.SetPlaySequence("")
 	if err := users.Put(id, user); err != nil {
 		Error.Printf("Can't reset the user\n\tUserID: %d\n\tUsername: %s\n\t%s",
 			id, user.GetName(), err)
@@ -951,254 +1765,334 @@ func userReset(id int64, users *Users) {
 }
 
 // MakeAMove implements user's move.
-func (b *Bot) MakeAMove(move byte, update tgbotapi.Update, botAPI *tgbotapi.BotAPI) {
-	reply, moves := "", ""
-	chatID := update.Message.Chat.ID
+func (b *Bot) MakeAMove(move byte, chatID int64) {
+	reply := ""
 
 	if b.stats.Get("game") == "false" {
 		reply = fmt.Sprintf("There is no game in process. To see the schedule " +
 			"plase use /status command or just tap to the Status button.")
-		replyTo(chatID, reply, botAPI, mainKeyboard)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
 		return
 	}
 
-	user := b.users.Get(chatID)
-	moves = user.GetPlaySequence()
-	if len(moves) > 0 && moves[len(moves)-1] == '#' {
-		moves = moves[:len(moves)-2]
+	commit, err := NewMoveCommit(move, false)
+	if err != nil {
+		Error.Printf("Can't commit the move:\n\tChatID: %d\n\t%s", chatID, err)
+		reply = "Something went wrong, please try again."
+		replyTo(chatID, reply, b.transport, b.opts.rules.Keyboard())
+		return
 	}
-	moves += string(move) + "#"
-	user.SetPlaySequence(moves)
-	if err := b.users.Put(chatID, user); err != nil {
-		Error.Printf("Can't put an element to the player's moves bucket\n\t%s", err)
+	// The first move of the throw is final unless it's allowed to change it
+	switch locked, err := b.state.Lock(chatID, commit, b.opts.changeMove); err {
+	case nil:
+	case errNoMatch:
+		reply = "You have no match in play right now, please wait for the next one."
+		replyTo(chatID, reply, b.transport, b.opts.rules.Keyboard())
+		return
+	case errMoveLocked:
+		reply = fmt.Sprintf("Your move *%s* is locked already \U0001f512", string(locked.Move))
+		replyTo(chatID, reply, b.transport, b.opts.rules.Keyboard())
+		return
+	default:
+		Error.Printf("Can't lock the move:\n\tChatID: %d\n\t%s", chatID, err)
+		reply = "Something went wrong, please try again."
+		replyTo(chatID, reply, b.transport, b.opts.rules.Keyboard())
+		return
 	}
 
-	reply = fmt.Sprintf("Your moves for now: %s*%s*",
-		moves[:len(moves)-2], string(moves[len(moves)-2]))
-	replyTo(chatID, reply, botAPI, gameKeyboard)
+	reply = fmt.Sprintf("Your moves for now: %s*%s*\nCommitment: `%s`",
+		b.state.Sequence(chatID), string(move), commit.Commitment(chatID))
+	if b.opts.changeMove {
+		reply += "\nYou can change your move until the time is over."
+	} else {
+		reply += "\nYour move is locked \U0001f512"
+	}
+	reply += " The move is revealed when the throw is over."
+	replyTo(chatID, reply, b.transport, b.opts.rules.Keyboard())
+
+	// Opponent holds the commitment as well, so the revealed move can be checked against it
+	if opponent, ok := b.state.Opponent(chatID); ok {
+		reply = fmt.Sprintf("Opponent's move is locked \U0001f512\nCommitment: `%s`", commit.Commitment(chatID))
+		if b.opts.changeMove {
+			reply = fmt.Sprintf("Opponent made a move, it can be changed until the time is over.\n"+
+				"Commitment: `%s`", commit.Commitment(chatID))
+		}
+		replyTo(opponent, reply, b.transport, b.opts.rules.Keyboard())
+	}
+
+	// Replies go first, so the commitment is seen before the move is revealed
+	notifyMove(chatID)
 }
 
-func round(
-	playerA, playerB int64,
-	users *Users,
-	ch chan int64,
-	wg *sync.WaitGroup,
-	opts *Options,
-	botAPI *tgbotapi.BotAPI,
-) {
-	defer wg.Done()
-	var winner, loser int64
-	reply := ""
+// liveMoves structure.
+// Implements MoveSource of the live game, moves are made by the players.
+type liveMoves struct {
+	state     *GameState
+	opts      *Options
+	transport Transport
+}
 
-	if playerA == -1 || playerB == -1 {
-		if playerA == -1 {
-			ch <- playerB
-			ch <- playerA
-		} else {
-			ch <- playerA
-			ch <- playerB
-		}
-		return
+// Pairs implements MoveSource, shuffled players at the end of the list get byes.
+func (m liveMoves) Pairs(round int, players []int64, fair Fair) ([][2]int64, []int64, error) {
+	pairs, byes := bracket(players, fair)
+
+	return pairs, byes, nil
+}
+
+// StartMatch implements MoveSource.
+func (m liveMoves) StartMatch(playerA, playerB int64) error {
+	if err := m.state.StartMatch(playerA, playerB); err != nil {
+		Error.Printf("Can't start the match:\n\tPlayerA: %d\n\tPlayerB: %d\n\t%s", playerA, playerB, err)
 	}
 
-	userA, userB := users.Get(playerA), users.Get(playerB)
-	playerASequence := userA.GetPlaySequence()
-	playerBSequence := userB.GetPlaySequence()
-	draw := rand.Intn(2)
+	return nil
+}
+
+// Throw implements MoveSource, players are given the round time to make their moves.
+func (m liveMoves) Throw(
+	round, match, number int,
+	playerA, playerB int64,
+	autoA, autoB byte,
+) (ThrowRecord, error) {
+	var t ThrowRecord
+	reply := ""
 
-	reply = fmt.Sprintf("You have %d second to make a move.", opts.roundTime)
+	// Locked moves aren't played yet and mustn't be seen by the opponent
+	playerASequence, playerBSequence := m.state.Sequence(playerA), m.state.Sequence(playerB)
+
+	reply = fmt.Sprintf("You have %d second to make a move.", m.opts.roundTime)
 	if playerBSequence != "" {
 		reply = fmt.Sprintf("Opponent's sequence: %s*%s*\nYou have %d second to make a move.",
 			playerBSequence[:len(playerBSequence)-1],
 			string(playerBSequence[len(playerBSequence)-1]),
-			opts.roundTime)
+			m.opts.roundTime)
 	}
-	replyTo(playerA, reply, botAPI, gameKeyboard)
-	reply = fmt.Sprintf("You have %d second to make a move.", opts.roundTime)
+	replyTo(playerA, reply, m.transport, m.opts.rules.Keyboard())
+	reply = fmt.Sprintf("You have %d second to make a move.", m.opts.roundTime)
 	if playerASequence != "" {
 		reply = fmt.Sprintf("Opponent's sequence: %s*%s*\nYou have %d second to make a move.",
 			playerASequence[:len(playerASequence)-1],
 			string(playerASequence[len(playerASequence)-1]),
-			opts.roundTime)
+			m.opts.roundTime)
 	}
-	replyTo(playerB, reply, botAPI, gameKeyboard)
+	replyTo(playerB, reply, m.transport, m.opts.rules.Keyboard())
 
 	// Timeout to let players make a move
-	time.Sleep(time.Duration(opts.roundTime) * time.Second)
-
-	if draw == 0 {
-		winner = playerA
-		loser = playerB
-	} else {
-		winner = playerB
-		loser = playerA
-	}
-
-	// Refresh player's sequences after the turn
-	playerASequence = userA.GetPlaySequence()
-	playerBSequence = userB.GetPlaySequence()
-
-	rps := []string{"R", "P", "S"}
-	if len(playerASequence) == 0 || playerASequence[len(playerASequence)-1] != '#' {
-		r1 := rand.Intn(len(rps))
-		playerASequence += rps[r1] + "#"
-		userA.SetPlaySequence(playerASequence)
-		if err := users.Put(playerA, userA); err != nil {
-			Error.Printf("Can't put updated user A play sequence\n\t%s", err)
-		}
-		reply = fmt.Sprintf("Your moves for now: %s*%s*",
-			playerASequence[:len(playerASequence)-2],
-			string(playerASequence[len(playerASequence)-2]))
-		replyTo(playerA, reply, botAPI, gameKeyboard)
-	}
-	if len(playerBSequence) == 0 || playerBSequence[len(playerBSequence)-1] != '#' {
-		r2 := rand.Intn(len(rps))
-		playerBSequence += rps[r2] + "#"
-		userB.SetPlaySequence(playerBSequence)
-		if err := users.Put(playerB, userB); err != nil {
-			Error.Printf("Can't put updated user B play sequence\n\t%s", err)
-		}
-		reply = fmt.Sprintf("Your moves for now: %s*%s*",
-			playerBSequence[:len(playerBSequence)-2],
-			string(playerBSequence[len(playerBSequence)-2]))
-		replyTo(playerB, reply, botAPI, gameKeyboard)
-	}
-
-	reply = fmt.Sprintf("Opponent's move: *%s*", string(playerBSequence[len(playerBSequence)-2]))
-	replyTo(playerA, reply, botAPI, gameKeyboard)
-	reply = fmt.Sprintf("Opponent's move: *%s*", string(playerASequence[len(playerASequence)-2]))
-	replyTo(playerB, reply, botAPI, gameKeyboard)
-
-	if playerASequence[len(playerASequence)-2] == 'R' {
-		switch playerBSequence[len(playerASequence)-2] {
-		case 'P':
-			winner = playerB
-			loser = playerA
-		case 'S':
-			winner = playerA
-			loser = playerB
-		}
-	} else if playerASequence[len(playerASequence)-2] == 'P' {
-		switch playerBSequence[len(playerASequence)-2] {
-		case 'R':
-			winner = playerA
-			loser = playerB
-		case 'S':
-			winner = playerB
-			loser = playerA
-		}
-	} else if playerASequence[len(playerASequence)-2] == 'S' {
-		switch playerBSequence[len(playerASequence)-2] {
-		case 'R':
-			winner = playerB
-			loser = playerA
-		case 'P':
-			winner = playerA
-			loser = playerB
-		}
-	}
-
-	ch <- winner
-	ch <- loser
+	waitMoves(playerA, playerB, m.state, m.opts)
+
+	// Moves are taken as they were locked, missing ones are made automatically
+	commitA := takeMove(playerA, m.state, m.opts, m.transport, autoA)
+	commitB := takeMove(playerB, m.state, m.opts, m.transport, autoB)
+	t.MoveA, t.AutoA, t.TimeA, t.NonceA, t.CommitA = string(commitA.Move), commitA.Auto,
+		commitA.Time, commitA.Nonce, commitA.Commitment(playerA)
+	t.MoveB, t.AutoB, t.TimeB, t.NonceB, t.CommitB = string(commitB.Move), commitB.Auto,
+		commitB.Time, commitB.Nonce, commitB.Commitment(playerB)
+
+	reply = fmt.Sprintf("Opponent's move: *%s*\nNonce: `%s`\nCommitment: `%s`",
+		t.MoveB, t.NonceB, t.CommitB)
+	replyTo(playerA, reply, m.transport, m.opts.rules.Keyboard())
+	reply = fmt.Sprintf("Opponent's move: *%s*\nNonce: `%s`\nCommitment: `%s`",
+		t.MoveA, t.NonceA, t.CommitA)
+	replyTo(playerB, reply, m.transport, m.opts.rules.Keyboard())
+
+	return t, nil
 }
 
-// Play starts the game.
-func (b *Bot) Play(botAPI *tgbotapi.BotAPI) {
-	Info.Printf("Game of %d players is starting", len(b.players))
+// ThrowOver implements MoveSource, players are told about draws and the score.
+func (m liveMoves) ThrowOver(t *ThrowRecord, playerA, playerB int64, winsA, winsB int) {
 	reply := ""
 
-	for len(b.players) > 1 {
-		gameChannels := NewSynMap()
+	if t.Winner == 0 {
+		reply = "Draw! The throw is replayed."
+		replyToMany([]int64{playerA, playerB}, reply, m.transport, m.opts.rules.Keyboard())
+		return
+	}
+	if t.CoinFlip {
+		reply = "Draw! There is no time to replay it, so the winner is picked by coin flip."
+		replyToMany([]int64{playerA, playerB}, reply, m.transport, m.opts.rules.Keyboard())
+	}
+	if m.opts.bestOf > 1 {
+		reply = fmt.Sprintf("Score: *%d - %d*", winsA, winsB)
+		replyTo(playerA, reply, m.transport, m.opts.rules.Keyboard())
+		reply = fmt.Sprintf("Score: *%d - %d*", winsB, winsA)
+		replyTo(playerB, reply, m.transport, m.opts.rules.Keyboard())
+	}
+}
 
-		// Pause in-between rounds
-		time.Sleep(time.Duration(b.opts.timeout) * time.Second)
+// EndMatch implements MoveSource.
+func (m liveMoves) EndMatch(playerA, playerB int64) {
+	if err := m.state.EndMatch(playerA); err != nil {
+		Error.Printf("Can't end the match:\n\tPlayerA: %d\n\tPlayerB: %d\n\t%s", playerA, playerB, err)
+	}
+}
 
-		rand.Shuffle(len(b.players),
-			func(i, j int) { b.players[i], b.players[j] = b.players[j], b.players[i] })
+// waitMoves waits until both players make a move, but not longer than the round time.
+// Moves can be changed until the round time is over if it's allowed, so it's waited in full then.
+func waitMoves(playerA, playerB int64, state *GameState, opts *Options) {
+	timer := time.NewTimer(time.Duration(opts.roundTime) * time.Second)
+	defer timer.Stop()
+	if opts.changeMove {
+		<-timer.C
+		return
+	}
 
-		var wg sync.WaitGroup
-		wg.Add(len(b.players) / 2)
+	// Signal is registered before moves are checked, so a move made in-between isn't missed
+	signal := make(chan struct{}, 2)
+	moveSignals.Put(playerA, signal)
+	moveSignals.Put(playerB, signal)
+	defer moveSignals.Delete(playerA)
+	defer moveSignals.Delete(playerB)
 
-		for i := 0; i < len(b.players); i += 2 {
-			ch := make(chan int64, 2)
-			gameChannels.Put(i, ch)
-			go round(b.players[i], b.players[i+1], b.users, ch, &wg, b.opts, botAPI)
+	for !state.Ready(playerA) {
+		select {
+		case <-signal:
+		case <-timer.C:
+			return
 		}
-		wg.Wait()
-		for _, ch := range gameChannels.Iterate() {
-			winner, loser := <-ch.(chan int64), <-ch.(chan int64)
-			idx := ContainsInt64(loser, b.players)
-			if idx != -1 {
-				b.players = append(b.players[:idx], b.players[idx+1:]...)
-			}
+	}
+}
 
-			userLoser := b.users.Get(loser)
-			userReset(loser, b.users)
-			userWinner := b.users.Get(winner)
-
-			userWinner.SetLastWonAmount(userWinner.GetLastWonAmount() + b.opts.ticketPrice)
-			if len(b.players) == 1 {
-				reply = fmt.Sprintf("You won the final prize \U0001f389 "+
-					"Won amount: *%f BCH* plus extra coins \U0001f381", userWinner.GetLastWonAmount())
-				if b.opts.donationAddress != "" {
-					reply += fmt.Sprintf(" You can support this bot by donating to *%s* "+
-						"Thank you and have a nice day \U0001f60a", b.opts.donationAddress)
-				}
-				replyTo(winner, reply, botAPI, gameKeyboard)
-				if err := PayToUser(userWinner, -1, b.opts.bankWalletPath, b.opts.testnet); err != nil {
-					Error.Printf("Couldn't pay to user:\n\tUserID: %d\n\tUsername: %s\n\t%s",
-						userWinner.GetUserID(), userWinner.GetName(), err)
-				}
-				Info.Printf("Final winner:\n\tUserID: %d\n\tUsername: %s\n\tAmount: %f",
-					userWinner.GetUserID(), userWinner.GetName(), userWinner.GetLastWonAmount())
-			} else {
-				reply = fmt.Sprintf("You win! Won amount: *%f BCH* \U0001f4b6",
-					userWinner.GetLastWonAmount())
-				replyTo(winner, reply, botAPI, gameKeyboard)
-				Info.Printf("Winner:\n\tUserID: %d\n\tUsername: %s\n\tAmount: %f",
-					userWinner.GetUserID(), userWinner.GetName(), userWinner.GetLastWonAmount())
-			}
+// notifyMove wakes up the throw waiting for the move of the player.
+func notifyMove(uid int64) {
+	if signal, ok := moveSignals.Get(uid).(chan struct{}); ok {
+		select {
+		case signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// takeMove returns locked move of the player and adds it to the played moves of its match.
+// The automatic move is taken if the player didn't make it.
+func takeMove(uid int64, state *GameState, opts *Options, transport Transport, auto byte) MoveCommit {
+	commit, ok := state.Take(uid)
+	if !ok {
+		var err error
+		if commit, err = NewMoveCommit(auto, true); err != nil {
+			Error.Printf("Can't commit the automatic move:\n\tUserID: %d\n\t%s", uid, err)
+			commit = MoveCommit{auto, time.Now(), "", true}
+		}
+	}
+
+	played := state.Sequence(uid)
+	if err := state.Settle(uid, commit); err != nil {
+		Error.Printf("Can't settle the move of the player\n\tUserID: %d\n\t%s", uid, err)
+	}
+	if commit.Auto {
+		reply := fmt.Sprintf("Your moves for now: %s*%s*", played, string(commit.Move))
+		replyTo(uid, reply, transport, opts.rules.Keyboard())
+	}
 
-			reply = fmt.Sprintf("You lose! Won amount: *%f BCH* \U0001f4b6",
+	return commit
+}
+
+// settleMatch tells the player the outcome of its match and pays its prize.
+func (b *Bot) settleMatch(uid int64, result matchResult, prize float64) {
+	reply := ""
+
+	if result == resultBye {
+		reply = "You have no opponent this round and pass to the next one."
+		replyTo(uid, reply, b.transport, b.opts.rules.Keyboard())
+		Info.Printf("Bye:\n\tUserID: %d", uid)
+		return
+	}
+
+	if result == resultLost {
+		userLoser := b.users.Get(uid)
+		userReset(uid, b.users)
+		userLoser.SetLastWonAmount(prize)
+		reply = fmt.Sprintf("You lose! Won amount: *%f BCH* \U0001f4b6",
+			userLoser.GetLastWonAmount())
+		if userLoser.GetLastWonAmount() > 0.0 {
+			userLoser.SetTotalWonAmount(userLoser.GetTotalWonAmount() +
 				userLoser.GetLastWonAmount())
-			if userLoser.GetLastWonAmount() > 0.0 {
-				if err := PayToUser(userLoser, userLoser.GetLastWonAmount(),
-					b.opts.bankWalletPath, b.opts.testnet); err != nil {
-					Error.Printf("Couldn't pay to user:\n\tUserID: %d\n\tUsername: %s\n\t%s",
-						userLoser.GetUserID(), userLoser.GetName(), err)
-				}
-				if userLoser.GetLastWonAmount() > b.opts.ticketPrice*3 &&
-					b.opts.donationAddress != "" {
-					reply += fmt.Sprintf(" \n\nYou can support this bot by donating to *%s* "+
-						"Thank you and have a nice day \U0001f60a", b.opts.donationAddress)
-				}
+			b.payToUser(userLoser, userLoser.GetLastWonAmount())
+			if userLoser.GetLastWonAmount() > b.opts.ticketPrice*3 &&
+				b.opts.donationAddress != "" {
+				reply += fmt.Sprintf(" \n\nYou can support this bot by donating to *%s* "+
+					"Thank you and have a nice day \U0001f60a", b.opts.donationAddress)
 			}
-			replyTo(loser, reply, botAPI, mainKeyboard)
-			Info.Printf("Loser:\n\tUserID: %d\n\tUsername: %s\n\tAmount: %f",
-				userLoser.GetUserID(), userLoser.GetName(), userLoser.GetLastWonAmount())
+		}
+		replyTo(uid, reply, b.transport, mainKeyboard)
+		Info.Printf("Loser:\n\tUserID: %d\n\tUsername: %s\n\tAmount: %f",
+			userLoser.GetUserID(), userLoser.GetName(), userLoser.GetLastWonAmount())
+		if err := b.users.Put(uid, userLoser); err != nil {
+			Error.Printf("Can't update loser after the round\n\t%s", err)
+		}
+		return
+	}
 
+	userWinner := b.users.Get(uid)
+	userWinner.SetLastWonAmount(prize)
+	if result == resultFinal {
+		reply = fmt.Sprintf("You won the final prize \U0001f389 "+
+			"Won amount: *%f BCH* \U0001f381", userWinner.GetLastWonAmount())
+		if b.opts.donationAddress != "" {
+			reply += fmt.Sprintf(" You can support this bot by donating to *%s* "+
+				"Thank you and have a nice day \U0001f60a", b.opts.donationAddress)
+		}
+		replyTo(uid, reply, b.transport, b.opts.rules.Keyboard())
+		if userWinner.GetLastWonAmount() > 0.0 {
 			userWinner.SetTotalWonAmount(userWinner.GetTotalWonAmount() +
 				userWinner.GetLastWonAmount())
-			if err := b.users.Put(winner, userWinner); err != nil {
-				Error.Printf("Can't update winner after the round\n\t%s", err)
-			}
+			b.payToUser(userWinner, userWinner.GetLastWonAmount())
 		}
+		Info.Printf("Final winner:\n\tUserID: %d\n\tUsername: %s\n\tAmount: %f",
+			userWinner.GetUserID(), userWinner.GetName(), userWinner.GetLastWonAmount())
+	} else {
+		reply = fmt.Sprintf("You win! Won amount: *%f BCH* \U0001f4b6",
+			userWinner.GetLastWonAmount())
+		replyTo(uid, reply, b.transport, b.opts.rules.Keyboard())
+		Info.Printf("Winner:\n\tUserID: %d\n\tUsername: %s\n\tAmount: %f",
+			userWinner.GetUserID(), userWinner.GetName(), userWinner.GetLastWonAmount())
+	}
 
-		for _, id := range b.players {
-			user := b.users.Get(id)
-			moves := user.GetPlaySequence()
-			if len(moves) > 0 && moves[len(moves)-1] == '#' {
-				moves = moves[:len(moves)-1]
-				user.SetPlaySequence(moves)
-				b.users.BatchPut(id, user)
-			}
+	if err := b.users.Put(uid, userWinner); err != nil {
+		Error.Printf("Can't update winner after the round\n\t%s", err)
+	}
+}
+
+// Play starts the game.
+// Game is played by the match format and the prizes of its record.
+func (b *Bot) Play() {
+	Info.Printf("Game of %d players is starting", len(b.players))
+
+	if b.game == nil && len(b.players) > 1 {
+		if err := b.restoreGameRecord(); err != nil {
+			Error.Printf("Can't create record of the game\n\t%s", err)
+		}
+	}
+
+	opts := *b.opts
+	if b.game != nil {
+		var err error
+		if opts, err = b.game.Options(b.opts); err != nil {
+			Error.Printf("Can't take options of the game\n\tGameID: %d\n\t%s", b.game.GameID, err)
+			opts = *b.opts
 		}
-		if err := b.users.BatchWrite(); err != nil {
-			Error.Printf("Can't remove terminal symbol from play sequences.")
+	}
+	game := newEngine(b.game, &opts, liveMoves{b.state, &opts, b.transport})
+
+	for round := 0; len(b.players) > 1; round++ {
+		// Pause in-between rounds, the first one starts right away
+		if round > 0 {
+			time.Sleep(time.Duration(b.opts.timeout) * time.Second)
+		}
+
+		players, err := game.playRound(b.players, b.settleMatch)
+		if err != nil {
+			Error.Printf("Can't play the round\n\tGameID: %d\n\t%s", b.game.GameID, err)
+			break
 		}
+		b.players = players
+		b.saveGameRecord()
+	}
+
+	if b.game != nil {
+		b.finishGameRecord()
 	}
 
-	b.GameReset(botAPI)
+	b.GameReset()
 	*b.leaderboard = []*User{}
 	for _, u := range formLeaderboard(b.users) {
 		*b.leaderboard = append(*b.leaderboard, u)
@@ -1211,19 +2105,54 @@ func (b *Bot) Play(botAPI *tgbotapi.BotAPI) {
 
 // Start starts the bot.
 func (b *Bot) Start() {
-	botAPI, err := tgbotapi.NewBotAPI(b.token)
-	if err != nil {
-		Error.Println("Can't authenticate with given token")
-		panic(err)
+	defer b.storage.Close()
+
+	Verbose.Printf("Loading users...")
+	users := NewUsers("users", b.storage)
+	b.users = &users
+	Verbose.Printf("%d users loaded", b.users.Len())
+
+	Verbose.Printf("Loading used names...")
+	b.names = b.storage.KV("names")
+	Verbose.Printf("%d used names loaded", b.names.Len())
+
+	Verbose.Printf("Loading seeds of the players...")
+	b.seeds = b.storage.KV("seeds")
+	Verbose.Printf("%d seeds loaded", b.seeds.Len())
+
+	Verbose.Printf("Loading games history...")
+	games := NewGames("games", b.storage)
+	b.games = &games
+	Verbose.Printf("%d games loaded", b.games.Len())
+
+	// Matches interrupted by restart are played again from their first throw
+	state := NewGameState("matches", b.storage)
+	b.state = &state
+	if err := b.state.Reset(); err != nil {
+		Error.Printf("Can't reset state of the game\n\t%s", err)
 	}
 
-	Info.Printf("Authorized on account %s", botAPI.Self.UserName)
+	b.stats = b.storage.KV("stats")
+
+	Verbose.Printf("Loading payout ledger...")
+	ledger := NewLedger("payouts", b.storage, b.stats)
+	b.ledger = &ledger
+	for _, entry := range b.ledger.List(func(e *LedgerEntry) bool { return e.Status == PayoutPending }) {
+		Warning.Printf("Payout was interrupted, check it manually:\n\tID: %d\n\tUserID: %d"+
+			"\n\tAddress: %s\n\tAmount: %f", entry.ID, entry.UserID, entry.Address, entry.Amount)
+	}
+	Verbose.Printf("%d payouts loaded", b.ledger.Len())
 
-	rand.Seed(time.Now().Unix())
+	Verbose.Printf("Loading ticket queue...")
+	queue := NewTicketQueue("queue", b.storage, b.stats)
+	b.queue = &queue
+	b.queueLegacyTickets()
+	Verbose.Printf("%d tickets queued", b.queue.Len())
+	b.creditOwed()
+	go b.retryPayouts()
 
 	Verbose.Printf("Restoring interrupted requests...")
-	*b.requests = NewLDBMap("requests", b.opts.dbPath)
-	defer b.requests.Close()
+	b.requests = b.storage.KV("requests")
 	for k := range b.requests.Iterate() {
 		chatID, err := strconv.ParseInt(k, 10, 64)
 		if err != nil {
@@ -1231,35 +2160,26 @@ func (b *Bot) Start() {
 		}
 		ch := make(chan bool)
 		payChannels.Put(chatID, ch)
-		go b.processBuyTicket(chatID, &payChannels, botAPI)
+		go b.processBuyTicket(chatID, &payChannels)
 		reply := "Something wrong has happened, sorry for inconvenience. " +
 			"Service just restarted and you can continue with your payment process."
-		replyTo(chatID, reply, botAPI, mainKeyboard)
+		replyTo(chatID, reply, b.transport, mainKeyboard)
 	}
 	Verbose.Printf("%d interrupted requests restored", b.requests.Len())
 
-	Verbose.Printf("Loading users...")
-	*b.users = NewUsers("users", b.opts.dbPath)
-	Verbose.Printf("%d users loaded", b.users.Len())
-
-	Verbose.Printf("Loading used names...")
-	*b.names = NewLDBMap("names", b.opts.dbPath)
-	Verbose.Printf("%d used names loaded", b.names.Len())
-
-	*b.stats = NewLDBMap("stats", b.opts.dbPath)
-	defer b.stats.Close()
 	if b.stats.Get("game") == "true" || b.stats.Get("ready") == "true" {
-		b.GameRestore(botAPI)
+		b.GameRestore()
 	}
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-
-	updates, err := botAPI.GetUpdatesChan(u)
+	updates, err := b.transport.Updates()
+	if err != nil {
+		Error.Println("Can't get updates from the transport")
+		panic(err)
+	}
 
 	b.crn.AddFunc(b.opts.schedule, func() {
 		if b.stats.Get("game") != "true" {
-			b.GamePrepare(botAPI)
+			b.GamePrepare()
 		}
 	})
 
@@ -1270,81 +2190,97 @@ func (b *Bot) Start() {
 	}
 
 	for update := range updates {
-		if update.Message != nil {
-			chatID := update.Message.Chat.ID
-			if clientOpTimeout.Exist(chatID) && clientOpTimeout.Get(chatID).(bool) {
-				reply := fmt.Sprintf(
-					"Please wait a little before calling again :) Timeout is equal to %d seconds.",
-					b.opts.opTimeout,
-				)
-				idx := ContainsInt64(chatID, b.players)
-				if idx != -1 {
-					replyTo(chatID, reply, botAPI, gameKeyboard)
-				} else {
-					replyTo(chatID, reply, botAPI, mainKeyboard)
-				}
-				continue
-			}
-			go clientOpTimeoutWatcher(chatID, b.opts)
-
-			Info.Printf("[%d] %s", chatID, update.Message.Text)
-
-			switch update.Message.Text {
-			case "/start", "start", "Start":
-				go b.Welcome(update, botAPI)
-				go b.Subscribe(update, botAPI)
-			case "/buyticket", "buyticket", "BuyTicket", "\U0001f39f BuyTicket":
-				go b.BuyTicket(update, botAPI)
-			case "/reset", "reset", "Reset", "\U0001f5d1 Reset":
-				go b.Reset(update, botAPI)
-			case "/subscribe", "subscribe", "Subscribe", "\U0001f4ec Subscribe":
-				go b.Subscribe(update, botAPI)
-			case "/unsubscribe", "unsubscribe", "Unsubscribe", "\U0001f4ed Unsubscribe":
-				go b.Unsubscribe(update, botAPI)
-			case "/status", "status", "Status", "\U0001f50d Status":
-				go b.Status(update, botAPI)
-			case "/changename", "change name", "Change name", "\U0001f3ad Change name":
-				go b.ChangeName(update, botAPI)
-			case "/changewalletaddress", "change wallet address",
-				"Change wallet address", "\U0001f4b3 Change wallet address":
-				go b.ChangeWalletAddress(update, botAPI)
-			case "/leaderboard", "leaderboard", "Leaderboard", "\U0001f3c6 Leaderboard":
-				go b.Leaderboard(update, botAPI)
-			case "/rock", "rock", "Rock", "\U000026f0 Rock":
-				go b.MakeAMove('R', update, botAPI)
-			case "/paper", "paper", "Paper", "\U0001f4c4 Paper":
-				go b.MakeAMove('P', update, botAPI)
-			case "/scissors", "scissors", "Scissors", "\U00002702 Scissors":
-				go b.MakeAMove('S', update, botAPI)
-			case "/help", "help", "Help", "\U00002753 Help":
-				go b.Welcome(update, botAPI)
-			default:
-				if clientModifyChannels.Exist(chatID) {
-					ch := clientModifyChannels.Get(chatID).(chan string)
-					ch <- update.Message.Text
-				}
+		chatID := update.ChatID
+		if clientOpTimeout.Exist(chatID) && clientOpTimeout.Get(chatID).(bool) {
+			reply := fmt.Sprintf(
+				"Please wait a little before calling again :) Timeout is equal to %d seconds.",
+				b.opts.opTimeout,
+			)
+			idx := ContainsInt64(chatID, b.players)
+			if idx != -1 && !update.Callback {
+				replyTo(chatID, reply, b.transport, b.opts.rules.Keyboard())
+			} else {
+				replyTo(chatID, reply, b.transport, mainKeyboard)
 			}
+			continue
 		}
+		go clientOpTimeoutWatcher(chatID, b.opts)
 
-		if update.CallbackQuery != nil {
-			chatID := update.CallbackQuery.Message.Chat.ID
-			if clientOpTimeout.Exist(chatID) && clientOpTimeout.Get(chatID).(bool) {
-				reply := fmt.Sprintf(
-					"Please wait a little before calling again :) Timeout is equal to %d seconds.",
-					b.opts.opTimeout,
-				)
-				replyTo(chatID, reply, botAPI, mainKeyboard)
+		Info.Printf("[%d] %s", chatID, update.Text)
+
+		if update.Callback {
+			switch update.Text {
+			case "yes":
+				go b.YesUnsubscribe(chatID)
+			case "no":
+				go b.NoUnsubscribe(chatID)
+			}
+
+			fields := strings.Fields(update.Text)
+			if len(fields) != 2 || parseTicketCount(fields[1]) == 0 {
 				continue
 			}
-			go clientOpTimeoutWatcher(chatID, b.opts)
+			count := parseTicketCount(fields[1])
+			switch fields[0] {
+			case "tickets":
+				go b.ChooseTicketPayment(chatID, count)
+			case "balance":
+				go b.BuyTicketFromBalance(chatID, count)
+			case "onchain":
+				go b.BuyTicketOnChain(chatID, count)
+			}
+			continue
+		}
 
-			Info.Printf("[%d] %s", chatID, update.CallbackQuery.Data)
+		if move, ok := b.opts.rules.Parse(update.Text); ok {
+			go b.MakeAMove(move, chatID)
+			continue
+		}
 
-			switch update.CallbackQuery.Data {
-			case "yes":
-				go b.YesUnsubscribe(update, botAPI)
-			case "no":
-				go b.NoUnsubscribe(update, botAPI)
+		if fields := strings.Fields(update.Text); len(fields) > 0 && fields[0] == "/verify" {
+			go b.Verify(chatID, fields[1:])
+			continue
+		}
+		if fields := strings.Fields(update.Text); len(fields) > 0 && fields[0] == "/seed" {
+			go b.Seed(chatID, fields[1:])
+			continue
+		}
+
+		switch update.Text {
+		case "/start", "start", "Start":
+			go b.Welcome(chatID)
+			go b.Subscribe(chatID, update.UserName)
+		case "/buyticket", "buyticket", "BuyTicket", "\U0001f39f BuyTicket":
+			go b.BuyTicket(chatID)
+		case "/reset", "reset", "Reset", "\U0001f5d1 Reset":
+			go b.Reset(chatID)
+		case "/subscribe", "subscribe", "Subscribe", "\U0001f4ec Subscribe":
+			go b.Subscribe(chatID, update.UserName)
+		case "/unsubscribe", "unsubscribe", "Unsubscribe", "\U0001f4ed Unsubscribe":
+			go b.Unsubscribe(chatID)
+		case "/status", "status", "Status", "\U0001f50d Status":
+			go b.Status(chatID)
+		case "/changename", "change name", "Change name", "\U0001f3ad Change name":
+			go b.ChangeName(chatID)
+		case "/changewalletaddress", "change wallet address",
+			"Change wallet address", "\U0001f4b3 Change wallet address":
+			go b.ChangeWalletAddress(chatID)
+		case "/history", "history", "History", "\U0001f4dc History":
+			go b.History(chatID)
+		case "/withdraw", "withdraw", "Withdraw", "\U0001f4b8 Withdraw":
+			go b.Withdraw(chatID)
+		case "/leaderboard", "leaderboard", "Leaderboard", "\U0001f3c6 Leaderboard":
+			go b.Leaderboard(chatID)
+		case "/help", "help", "Help", "\U00002753 Help":
+			go b.Welcome(chatID)
+		case "/queue":
+			if b.opts.operatorID != 0 && chatID == b.opts.operatorID {
+				go b.Queue(chatID)
+			}
+		default:
+			if clientModifyChannels.Exist(chatID) {
+				ch := clientModifyChannels.Get(chatID).(chan string)
+				ch <- update.Text
 			}
 		}
 	}
@@ -0,0 +1,300 @@
+package rps
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// waitMessage waits until the bot sends to the chat a message containing text and returns it.
+func waitMessage(t *testing.T, recorder *Recorder, chatID int64, text string, timeout time.Duration) string {
+	t.Helper()
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		for _, msg := range recorder.Messages(chatID) {
+			if strings.Contains(msg.Text, text) {
+				return msg.Text
+			}
+		}
+	}
+	t.Fatalf("chat %d didn't get %q in %s", chatID, text, timeout)
+
+	return ""
+}
+
+// pushUpdate delivers the update and waits for the reply containing text.
+func pushUpdate(t *testing.T, recorder *Recorder, update Update, text string) {
+	t.Helper()
+	recorder.Push(update)
+	waitMessage(t, recorder, update.ChatID, text, 5*time.Second)
+	// Timeout of operations of the user is over right after the reply
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestGameLifecycle(t *testing.T) {
+	if testing.Short() {
+		t.Skip("game takes about 25 seconds")
+	}
+
+	storage := openTestStorage(t)
+	recorder := NewRecorder()
+	cashbox, bank := NewFakeWallet(0), NewFakeWallet(0)
+	opts := NewOptions(128, 0, 0, 60, 1, 5, "0 0 0 1 1 *", 0.001, "", 0.002, 0, 0,
+		NewProgressiveRefund(0.001), 0, 0, "", 1, 2, ClassicRules(), false)
+	leaderboard := []*User{}
+	b := New(recorder, &opts, cron.New(), cashbox, bank, storage, []int64{}, &leaderboard)
+	done := make(chan struct{})
+	go func() {
+		b.Start()
+		close(done)
+	}()
+	defer func() {
+		recorder.Close()
+		<-done
+	}()
+
+	ids := []int64{1, 2}
+	address := func(id int64) string {
+		return fmt.Sprintf("bchtest:q%041d", id)
+	}
+	for _, id := range ids {
+		pushUpdate(t, recorder, Update{ChatID: id, UserName: fmt.Sprintf("user%d", id), Text: "/start"},
+			"You're now subscribed!")
+		pushUpdate(t, recorder, Update{ChatID: id, Text: "/changewalletaddress"}, "Enter new wallet address")
+	}
+	// Entered address is taken when the wait for it is polled, so both are waited at once
+	for _, id := range ids {
+		recorder.Push(Update{ChatID: id, Text: address(id)})
+	}
+	for _, id := range ids {
+		waitMessage(t, recorder, id, "Wallet set successfully!", 15*time.Second)
+	}
+	time.Sleep(100 * time.Millisecond)
+	for _, id := range ids {
+		pushUpdate(t, recorder, Update{ChatID: id, Text: "/buyticket"}, "How many tickets")
+		pushUpdate(t, recorder, Update{ChatID: id, Text: "tickets 1", Callback: true}, "to pay")
+	}
+
+	// Paying a request twice doesn't pay for more tickets
+	requests := cashbox.Requests()
+	if len(requests) != len(ids) {
+		t.Fatalf("%d payment requests are created", len(requests))
+	}
+	for _, request := range requests {
+		if status := cashbox.RequestStatus(request); status != "Pending" {
+			t.Errorf("request %s is %q before it's paid", request, status)
+		}
+		for i := 0; i < 2; i++ {
+			if err := cashbox.MarkPaid(request); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if status := cashbox.RequestStatus(request); status != "Paid" {
+			t.Errorf("request %s is %q after it's paid", request, status)
+		}
+	}
+	if balance, _ := cashbox.GetBalance(); balance < 0.001999 || balance > 0.002001 {
+		t.Fatalf("cashbox got %f for the tickets", balance)
+	}
+	for _, id := range ids {
+		waitMessage(t, recorder, id, "You've got *1* tickets", 10*time.Second)
+	}
+
+	// Seed hash of the game is published before it's started
+	pushUpdate(t, recorder, Update{ChatID: 1, Text: "/status"}, "Next game seed hash")
+	b.GamePrepare()
+	for _, id := range ids {
+		waitMessage(t, recorder, id, "Game #1 is over", 30*time.Second)
+	}
+
+	game, err := NewGames("games", storage).Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Winner != 1 && game.Winner != 2 {
+		t.Errorf("winner of the game is %d", game.Winner)
+	}
+	if problems := VerifyGame(&game); len(problems) > 0 {
+		t.Errorf("game isn't verified: %v", problems)
+	}
+	replayed, err := ReplayGame(&game, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := CompareGames(&game, &replayed); len(problems) > 0 {
+		t.Errorf("replay differs: %v", problems)
+	}
+
+	// Prizes are sent to the wallets of the players as they're recorded in the game
+	recorded := map[string]float64{}
+	for _, payout := range game.Payouts {
+		if payout.Address != address(payout.UserID) || payout.TxID == "" {
+			t.Errorf("payout %v isn't sent to the wallet of the player", payout)
+		}
+		recorded[payout.Address] += payout.Amount
+	}
+	if winner := bank.Payouts(address(game.Winner)); len(winner) != 1 || winner[0] <= 0 ||
+		winner[0] != recorded[address(game.Winner)] {
+		t.Errorf("winner is paid %v, %f is recorded", winner, recorded[address(game.Winner)])
+	}
+	all := bank.AllPayouts()
+	if len(all) != len(recorded) {
+		t.Errorf("payouts are sent to %d addresses, %d are recorded", len(all), len(recorded))
+	}
+	sent := 0.0
+	for addr, amounts := range all {
+		total := 0.0
+		for _, amount := range amounts {
+			total += amount
+		}
+		if math.Abs(total-recorded[addr]) > 1e-9 {
+			t.Errorf("%s is paid %v, %f is recorded", addr, amounts, recorded[addr])
+		}
+		sent += total
+	}
+
+	// Money of the played tickets is moved to the bank, the rest of the pot is kept there
+	if balance, _ := cashbox.GetBalance(); balance != 0 {
+		t.Errorf("cashbox keeps %f after the game", balance)
+	}
+	if balance, _ := bank.GetBalance(); math.Abs(balance+sent-0.002) > 1e-9 {
+		t.Errorf("bank keeps %f after sending %f of the game", balance, sent)
+	}
+}
+
+// newTestBot returns bot of the registered players having all its vaults, wallets and transport.
+// Players aren't seated to a game.
+func newTestBot(t *testing.T, players ...int64) (*Bot, *Recorder, *FakeWallet, *FakeWallet) {
+	t.Helper()
+	b := newSeedTestBot(t, players...)
+	b.opts.capacity, b.opts.minWithdrawal = 128, 0.002
+	recorder, cashbox, bank := NewRecorder(), NewFakeWallet(0), NewFakeWallet(0)
+	queue := NewTicketQueue("queue", b.storage, b.stats)
+	state := NewGameState("state", b.storage)
+	ledger := NewLedger("payouts", b.storage, b.stats)
+	b.transport, b.cashbox, b.bank, b.queue, b.state, b.ledger, b.players =
+		recorder, cashbox, bank, &queue, &state, &ledger, []int64{}
+
+	return b, recorder, cashbox, bank
+}
+
+func TestGamePrepareReturnsTickets(t *testing.T) {
+	b, recorder, cashbox, _ := newTestBot(t, 1, 2)
+	cashbox.Deposit(0.002)
+	for _, id := range []int64{1, 2} {
+		if err := b.giveTickets(b.users.Get(id), newTickets(1, false, b.opts)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.nextSeedHash()
+
+	// Game can't start while money of the tickets can't be moved to the bank,
+	// so every attempt seats the players anew
+	cashbox.SetPayToError(errors.New("network down"))
+	for i := 0; i < 2; i++ {
+		b.GamePrepare()
+		if len(b.players) != 0 || b.game != nil {
+			t.Fatalf("attempt %d: %d players are seated in game %v", i, len(b.players), b.game)
+		}
+		for _, id := range []int64{1, 2} {
+			user := b.users.Get(id)
+			if tickets := user.GetTickets(); len(tickets) != 1 || tickets[0].FromBalance || user.GetIsPlayer() {
+				t.Errorf("attempt %d: user %d has tickets %v, player %t", i, id, tickets, user.GetIsPlayer())
+			}
+		}
+		if queued := b.queue.Len(); queued != 2 {
+			t.Errorf("attempt %d: %d tickets are queued", i, queued)
+		}
+	}
+	if balance, _ := cashbox.GetBalance(); balance != 0.002 {
+		t.Errorf("cashbox keeps %f", balance)
+	}
+	if n := len(recorder.Messages(1)); n == 0 {
+		t.Error("player isn't told the game couldn't start")
+	}
+}
+
+func TestGameRecordRestore(t *testing.T) {
+	b, _, _, bank := newTestBot(t, 1, 2)
+	bank.Deposit(1)
+	b.opts.feePercent, b.opts.operatorAddress = 10, "bchtest:qoperator"
+	if err := b.stats.Put("jackpot", "0.5"); err != nil {
+		t.Fatal(err)
+	}
+	b.players = []int64{1, 2}
+	b.nextSeedHash()
+	if err := b.startGameRecord(false); err != nil {
+		t.Fatal(err)
+	}
+	started := *b.game
+	if started.Jackpot != 0.5 || started.Fee < 0.000199 || started.Fee > 0.000201 || getJackpot(b.stats) != 0 {
+		t.Fatalf("game is started with jackpot %f and fee %f, jackpot left %f",
+			started.Jackpot, started.Fee, getJackpot(b.stats))
+	}
+
+	// Restored game keeps the pot it was started with
+	b.game = nil
+	if err := b.restoreGameRecord(); err != nil {
+		t.Fatal(err)
+	}
+	if b.game.GameID != started.GameID || b.game.Pot != started.Pot || b.game.Fee != started.Fee {
+		t.Errorf("game %d with pot %f and fee %f is restored as game %d with pot %f and fee %f",
+			started.GameID, started.Pot, started.Fee, b.game.GameID, b.game.Pot, b.game.Fee)
+	}
+
+	// Lost record is started anew without taking the jackpot and the fee again
+	if err := b.stats.Put("jackpot", "0.3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.stats.Put("currentGame", "99"); err != nil {
+		t.Fatal(err)
+	}
+	b.game = nil
+	if err := b.restoreGameRecord(); err != nil {
+		t.Fatal(err)
+	}
+	if b.game.Jackpot != 0 || math.Abs(b.game.Pot-0.0018) > 1e-9 || getJackpot(b.stats) != 0.3 {
+		t.Errorf("lost game is restored with jackpot %f and pot %f, jackpot left %f",
+			b.game.Jackpot, b.game.Pot, getJackpot(b.stats))
+	}
+	if payouts := bank.Payouts("bchtest:qoperator"); len(payouts) != 1 {
+		t.Errorf("fee is paid as %v", payouts)
+	}
+}
+
+func TestGameRestoreFinished(t *testing.T) {
+	b, _, _, _ := newTestBot(t, 1, 2)
+	b.players = []int64{1, 2}
+	b.nextSeedHash()
+	if err := b.startGameRecord(false); err != nil {
+		t.Fatal(err)
+	}
+	b.game.EndTime = time.Now()
+	b.saveGameRecord()
+	for _, id := range b.players {
+		user := b.users.Get(id)
+		user.SetIsPlayer(true)
+		if err := b.users.Put(id, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.stats.Put("game", "true"); err != nil {
+		t.Fatal(err)
+	}
+	lastGameID := b.stats.Get("lastGameID")
+
+	// Game over before the crash isn't played again
+	b.game, b.players = nil, []int64{}
+	b.GameRestore()
+	if b.stats.Get("game") != "false" || b.stats.Get("lastGameID") != lastGameID || len(b.players) != 0 {
+		t.Errorf("finished game is restored, game %s, last game %s, players %v",
+			b.stats.Get("game"), b.stats.Get("lastGameID"), b.players)
+	}
+	if players := b.users.Players(); len(players) != 0 {
+		t.Errorf("%d users are left playing", len(players))
+	}
+}
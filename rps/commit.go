@@ -0,0 +1,47 @@
+package rps
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// MoveCommit structure.
+// Move locked by a hash commitment, the commitment is given to the player
+// when the move is made and the move with its nonce are revealed when the throw is over.
+type MoveCommit struct {
+	Move  byte      `json:"move"`
+	Time  time.Time `json:"time"`
+	Nonce string    `json:"nonce"`
+	Auto  bool      `json:"auto"`
+}
+
+// NewMoveCommit creates an object of MoveCommit structure with server time and random nonce.
+func NewMoveCommit(move byte, auto bool) (MoveCommit, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return MoveCommit{}, err
+	}
+
+	return MoveCommit{move, time.Now(), hex.EncodeToString(nonce), auto}, nil
+}
+
+// Commitment returns hash of the move of the user.
+func (c MoveCommit) Commitment(uid int64) string {
+	return moveCommitment(uid, string(c.Move), c.Time, c.Nonce)
+}
+
+// moveCommitment returns hex encoded SHA-256 of the user ID, the move, its time and nonce.
+func moveCommitment(uid int64, move string, t time.Time, nonce string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%d:%s", uid, move, t.UnixNano(), nonce)))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyThrow checks if revealed moves of the throw match their commitments.
+func VerifyThrow(t ThrowRecord, playerA, playerB int64) bool {
+	return moveCommitment(playerA, t.MoveA, t.TimeA, t.NonceA) == t.CommitA &&
+		moveCommitment(playerB, t.MoveB, t.TimeB, t.NonceB) == t.CommitB
+}
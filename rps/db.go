@@ -0,0 +1,132 @@
+package rps
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Namespaces of the databases used before all of them were merged into one.
+var legacyNamespaces = []string{"requests", "users", "names", "stats"}
+
+const legacyImportedKey = "meta:legacyImported"
+
+// DB structure.
+// Single LevelDB database shared by all the vaults,
+// each vault keeps its keys under its own namespace prefix.
+type DB struct {
+	ldb  *leveldb.DB
+	path string
+}
+
+// NewDB creates an object of DB structure.
+func NewDB(dbPath string) DB {
+	path := filepath.Join(dbPath, "rps")
+	ldb, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		Error.Printf("Can't get access to database:\n\tDBPath: %s", path)
+		panic(err)
+	}
+
+	return DB{ldb, path}
+}
+
+// KV opens a vault of strings.
+func (d DB) KV(name string) KVStore {
+	return NewLDBMap(name, d)
+}
+
+// Users opens a vault of users.
+func (d DB) Users(name string) UserStore {
+	return NewUMap(name, d)
+}
+
+// Update runs fn and commits all the changes it made through tx in a single write.
+// Nothing is written if fn returns an error.
+func (d DB) Update(fn func(tx *Tx) error) error {
+	tx := &Tx{}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	for _, op := range tx.ops {
+		if op.delete {
+			batch.Delete(namespaceKey(op.namespace, op.key))
+		} else {
+			batch.Put(namespaceKey(op.namespace, op.key), op.value)
+		}
+	}
+	if err := d.ldb.Write(batch, nil); err != nil {
+		return err
+	}
+	tx.commit()
+
+	return nil
+}
+
+// Close closes the database.
+func (d DB) Close() {
+	d.ldb.Close()
+}
+
+// namespaceKey returns key of the database which belongs to the namespace.
+func namespaceKey(namespace string, key string) []byte {
+	return []byte(namespace + ":" + key)
+}
+
+// namespaceIterate calls fn for each key of the namespace with the prefix stripped.
+func (d DB) namespaceIterate(namespace string, fn func(key []byte, value []byte)) error {
+	prefix := namespaceKey(namespace, "")
+	iter := d.ldb.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		fn(iter.Key()[len(prefix):], iter.Value())
+	}
+
+	return iter.Error()
+}
+
+// ImportLegacy copies databases of the four-directory layout
+// (requests, users, names and stats under dbPath) into the namespaces of d.
+// Import happens only once, the old directories are left untouched.
+// Returns number of imported keys.
+func ImportLegacy(dbPath string, d DB) (int, error) {
+	if ok, err := d.ldb.Has([]byte(legacyImportedKey), nil); err != nil || ok {
+		return 0, err
+	}
+
+	batch := new(leveldb.Batch)
+	for _, namespace := range legacyNamespaces {
+		path := filepath.Join(dbPath, namespace)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+
+		ldb, err := leveldb.OpenFile(path, nil)
+		if err != nil {
+			return 0, err
+		}
+		iter := ldb.NewIterator(nil, nil)
+		for iter.Next() {
+			batch.Put(namespaceKey(namespace, string(iter.Key())), append([]byte{}, iter.Value()...))
+		}
+		iter.Release()
+		err = iter.Error()
+		ldb.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := batch.Len()
+	batch.Put([]byte(legacyImportedKey), []byte("true"))
+	if err := d.ldb.Write(batch, nil); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,209 @@
+package rps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ElectronCash structure.
+// Implements Wallet by calling electron-cash CLI.
+type ElectronCash struct {
+	walletPath string
+	testnet    bool
+}
+
+// NewElectronCash creates an object of ElectronCash structure.
+func NewElectronCash(walletPath string, testnet bool) ElectronCash {
+	return ElectronCash{walletPath, testnet}
+}
+
+// GetBalance returns current balance of specified wallet
+func (w ElectronCash) GetBalance() (float64, error) {
+	var request map[string]json.RawMessage
+	var _confirmed, _unconfirmed string
+
+	testnetArg := ""
+	if w.testnet {
+		testnetArg = " --testnet"
+	}
+
+	_res, err := ExecCMD(fmt.Sprintf("electron-cash -w %s getbalance"+testnetArg,
+		w.walletPath))
+	if err != nil {
+		if string(_res) == "false\n" {
+			return 0, errors.New("payto return false")
+		}
+		return 0, err
+	}
+
+	err = json.Unmarshal(_res, &request)
+	if err != nil {
+		return 0, err
+	}
+	json.Unmarshal(request["confirmed"], &_confirmed)
+	if _, ok := request["unconfirmed"]; ok {
+		json.Unmarshal(request["unconfirmed"], &_unconfirmed)
+	}
+	confirmed, err := strconv.ParseFloat(string(_confirmed), 64)
+	if err != nil {
+		return 0, err
+	}
+	if _unconfirmed != "" {
+		unconfirmed, err := strconv.ParseFloat(string(_unconfirmed), 64)
+		if err != nil {
+			return 0, err
+		}
+		return confirmed + unconfirmed, nil
+	}
+
+	return confirmed, nil
+}
+
+// GetRequest returns request's metadata
+func (w ElectronCash) GetRequest(requestID string) (map[string]json.RawMessage, error) {
+	var request map[string]json.RawMessage
+
+	testnetArg := ""
+	if w.testnet {
+		testnetArg = " --testnet"
+	}
+
+	res, err := ExecCMD(fmt.Sprintf("electron-cash -w %s getrequest %s"+testnetArg,
+		w.walletPath, requestID))
+	if err != nil {
+		return map[string]json.RawMessage{}, err
+	}
+
+	if err := json.Unmarshal(res, &request); err != nil {
+		return map[string]json.RawMessage{}, err
+	}
+
+	return request, nil
+}
+
+// PayTo performs pay to specified address and returns ID of the transaction
+func (w ElectronCash) PayTo(dstAddress string, amount float64) (string, error) {
+	var request map[string]json.RawMessage
+	var hexID, txID string
+	var broadcast []json.RawMessage
+	var res []byte
+	var err error
+
+	testnetArg := ""
+	if w.testnet {
+		testnetArg = " --testnet"
+	}
+
+	if amount != -1 {
+		res, err = ExecCMD(fmt.Sprintf("electron-cash -w %s payto %s %f"+testnetArg,
+			w.walletPath, dstAddress, amount))
+	} else {
+		res, err = ExecCMD(fmt.Sprintf("electron-cash -w %s payto %s !"+testnetArg,
+			w.walletPath, dstAddress))
+	}
+	if err != nil {
+		if string(res) == "false\n" {
+			return "", errors.New("payto return false")
+		}
+		return "", err
+	}
+
+	err = json.Unmarshal(res, &request)
+	if err != nil {
+		return "", err
+	}
+	json.Unmarshal(request["hex"], &hexID)
+
+	res, err = ExecCMD(fmt.Sprintf("electron-cash -w %s broadcast %s"+testnetArg,
+		w.walletPath, hexID))
+	if err != nil {
+		if string(res) == "false\n" {
+			return "", errors.New("broadcast return false")
+		}
+		return "", err
+	}
+
+	// Broadcast returns either [true, "txid"] or just "txid" depending on the version
+	if err := json.Unmarshal(res, &broadcast); err == nil && len(broadcast) == 2 {
+		json.Unmarshal(broadcast[1], &txID)
+	} else if err := json.Unmarshal(res, &txID); err != nil {
+		txID = strings.TrimSpace(string(res))
+	}
+
+	return txID, nil
+}
+
+// CreateRequest creates payment request
+func (w ElectronCash) CreateRequest(amount float64) (string, string, error) {
+	var request map[string]json.RawMessage
+	var address, url string
+
+	testnetArg := ""
+	if w.testnet {
+		testnetArg = " --testnet"
+	}
+
+	res, err := ExecCMD(fmt.Sprintf("electron-cash -w %s addrequest %f"+testnetArg,
+		w.walletPath, amount))
+	if err != nil {
+		return "", "", err
+	}
+
+	err = json.Unmarshal(res, &request)
+	if err != nil {
+		if string(res) == "false\n" {
+			return "", "", errors.New("addrequest return false")
+		}
+		return "", "", err
+	}
+
+	if err := json.Unmarshal(request["address"], &address); err != nil {
+		return "", "", err
+	}
+	if err := json.Unmarshal(request["URI"], &url); err != nil {
+		return "", "", err
+	}
+
+	return address, url, nil
+}
+
+// RemoveRequest removes payment request
+func (w ElectronCash) RemoveRequest(requestID string) error {
+	testnetArg := ""
+	if w.testnet {
+		testnetArg = " --testnet"
+	}
+
+	res, err := ExecCMD(fmt.Sprintf("electron-cash -w %s rmrequest %s"+testnetArg,
+		w.walletPath, requestID))
+	if err != nil {
+		return err
+	}
+	if string(res) == "false\n" {
+		return errors.New("rmrequest return false")
+	}
+
+	return nil
+}
+
+// ClearRequests removes all active requests
+func (w ElectronCash) ClearRequests() error {
+	testnetArg := ""
+	if w.testnet {
+		testnetArg = " --testnet"
+	}
+
+	res, err := ExecCMD(fmt.Sprintf("electron-cash -w %s clearrequests"+testnetArg,
+		w.walletPath))
+	if err != nil {
+		return err
+	}
+	if string(res) == "false\n" {
+		return errors.New("clearrequests return false")
+	}
+
+	return nil
+}
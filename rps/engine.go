@@ -0,0 +1,185 @@
+package rps
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MoveSource gives moves of the players to the matches of a game.
+// Moves are made by the players in a live game and taken from the record in a replay.
+type MoveSource interface {
+	// Pairs returns pairs of the players of the round and the players passing it by a bye.
+	Pairs(round int, players []int64, fair Fair) ([][2]int64, []int64, error)
+	// StartMatch is called before the first throw of the match.
+	StartMatch(playerA, playerB int64) error
+	// Throw returns moves of the throw of the match, autoA and autoB are taken
+	// for the players who didn't make a move. Winner of the throw is set only
+	// if the source decides it on its own, otherwise the throw is resolved by its moves.
+	Throw(round, match, number int, playerA, playerB int64, autoA, autoB byte) (ThrowRecord, error)
+	// ThrowOver is called with the resolved throw and the score of the match.
+	ThrowOver(t *ThrowRecord, playerA, playerB int64, winsA, winsB int)
+	// EndMatch is called when the match is over.
+	EndMatch(playerA, playerB int64)
+}
+
+// matchResult is the outcome of a match for a player.
+type matchResult int
+
+const (
+	resultBye matchResult = iota
+	resultLost
+	resultWon
+	resultFinal
+)
+
+// payFunc settles the outcome of the match for the player.
+// Prize of the winner is paid only in the final, otherwise it's what the player would get by now.
+type payFunc func(uid int64, result matchResult, prize float64)
+
+// engine structure.
+// Plays the game by its bracket, both the live one and its replay.
+type engine struct {
+	game  *GameRecord
+	opts  *Options
+	moves MoveSource
+}
+
+// newEngine creates an object of engine structure.
+func newEngine(game *GameRecord, opts *Options, moves MoveSource) engine {
+	return engine{game, opts, moves}
+}
+
+// playRound plays the next round of the game between the players, adds it to the record
+// and settles its matches in order of the bracket.
+// Returns players passed to the next round.
+func (e engine) playRound(players []int64, pay payFunc) ([]int64, error) {
+	roundRecord := RoundRecord{len(e.game.Rounds) + 1, []MatchRecord{}}
+	fair := e.game.Fair().Sub("round", roundRecord.Number)
+	pairs, byes, err := e.moves.Pairs(roundRecord.Number, players, fair)
+	if err != nil {
+		return players, err
+	}
+	if len(pairs) == 0 {
+		return players, fmt.Errorf("round %d has no matches", roundRecord.Number)
+	}
+
+	// Matches of the round are played at the same time
+	matches := make([]MatchRecord, len(pairs))
+	errs := make([]error, len(pairs))
+	var wg sync.WaitGroup
+	wg.Add(len(pairs))
+	for i, pair := range pairs {
+		go func(i int, playerA, playerB int64) {
+			defer wg.Done()
+			matches[i], errs[i] = e.playMatch(roundRecord.Number, i, playerA, playerB, fair.Sub("match", i))
+		}(i, pair[0], pair[1])
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return players, fmt.Errorf("round %d match %d: %s", roundRecord.Number, i+1, err)
+		}
+	}
+
+	// Player of the bye has no match, so its moves aren't taken
+	for _, id := range byes {
+		matches = append(matches, MatchRecord{PlayerA: id, PlayerB: -1, Winner: id, Loser: -1})
+	}
+
+	players = append([]int64{}, players...)
+	for _, match := range matches {
+		roundRecord.Matches = append(roundRecord.Matches, match)
+		winner, loser := match.Winner, match.Loser
+
+		// Bye isn't a win, so it doesn't add up to the won amount
+		if loser == -1 {
+			pay(winner, resultBye, 0)
+			continue
+		}
+
+		if idx := ContainsInt64(loser, players); idx != -1 {
+			players = append(players[:idx], players[idx+1:]...)
+		}
+
+		// Loser is paid first, the final winner may take the rest of the pot
+		pay(loser, resultLost, e.game.Prize(e.opts.prizeStrategy, e.game.Place(loser, roundRecord.Number)))
+
+		// The match isn't recorded yet, so it's counted to the place of the winner
+		place := e.game.Place(winner, roundRecord.Number+1)
+		place.Wins++
+		prize := e.game.Prize(e.opts.prizeStrategy, place)
+		if len(players) == 1 {
+			e.game.Winner = winner
+			pay(winner, resultFinal, prize)
+		} else {
+			pay(winner, resultWon, prize)
+		}
+	}
+
+	e.game.Rounds = append(e.game.Rounds, roundRecord)
+
+	return players, nil
+}
+
+// playMatch plays throws of the match until one of the players wins it.
+// Draws are replayed while the match has time for them.
+// Time of a throw is counted by its upper bound, so replays don't depend on speed of the players.
+func (e engine) playMatch(round, number int, playerA, playerB int64, fair Fair) (MatchRecord, error) {
+	match := MatchRecord{PlayerA: playerA, PlayerB: playerB}
+	if err := e.moves.StartMatch(playerA, playerB); err != nil {
+		return match, err
+	}
+	// Moves made after the last throw of the match don't count
+	defer e.moves.EndMatch(playerA, playerB)
+
+	need := int(e.opts.bestOf/2 + 1)
+	winsA, winsB := 0, 0
+	var replayTime uint
+	for winsA < need && winsB < need {
+		throwFair := fair.Sub("throw", len(match.Throws))
+		replay := replayTime+e.opts.roundTime <= e.opts.drawTimeout
+		t, err := e.moves.Throw(round, number, len(match.Throws), playerA, playerB,
+			autoMove(e.opts.rules, throwFair, "A"), autoMove(e.opts.rules, throwFair, "B"))
+		if err != nil {
+			return match, err
+		}
+		if t.Winner == 0 {
+			resolveThrow(&t, playerA, playerB, e.opts.rules, throwFair, replay)
+		}
+		match.Throws = append(match.Throws, t)
+
+		switch t.Winner {
+		case playerA:
+			winsA++
+		case playerB:
+			winsB++
+		default:
+			replayTime += e.opts.roundTime
+		}
+		e.moves.ThrowOver(&t, playerA, playerB, winsA, winsB)
+	}
+
+	last := match.Throws[len(match.Throws)-1]
+	match.MoveA, match.MoveB, match.AutoA, match.AutoB, match.CoinFlip =
+		last.MoveA, last.MoveB, last.AutoA, last.AutoB, last.CoinFlip
+	if winsA > winsB {
+		match.Winner, match.Loser = playerA, playerB
+	} else {
+		match.Winner, match.Loser = playerB, playerA
+	}
+
+	return match, nil
+}
+
+// resolveThrow sets winner of the throw by its moves.
+// Coin flip is the last resort when draws took all the time, otherwise draw is left to replay.
+func resolveThrow(t *ThrowRecord, playerA, playerB int64, rules RuleSet, fair Fair, replay bool) {
+	if rules.Beats(t.MoveA[0], t.MoveB[0]) {
+		t.Winner = playerA
+	} else if rules.Beats(t.MoveB[0], t.MoveA[0]) {
+		t.Winner = playerB
+	} else if !replay {
+		t.CoinFlip = true
+		t.Winner = coinFlip(fair, playerA, playerB)
+	}
+}
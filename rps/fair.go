@@ -0,0 +1,219 @@
+package rps
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Seed players can add to the client seed.
+var playerSeedFormat = regexp.MustCompile("^[A-Za-z0-9_-]{1,64}$")
+
+// Fair structure.
+// Provably fair source of randomness of a game.
+// Each number is HMAC-SHA256 of the client seed and the path of labels keyed by the server seed,
+// so results don't depend on the order matches are played in and can be recomputed
+// once the server seed is revealed.
+type Fair struct {
+	serverSeed string
+	clientSeed string
+	path       string
+}
+
+// NewFair creates an object of Fair structure.
+func NewFair(serverSeed, clientSeed string) Fair {
+	return Fair{serverSeed, clientSeed, ""}
+}
+
+// Sub returns source of randomness scoped by the labels, e.g. round and match.
+func (f Fair) Sub(labels ...interface{}) Fair {
+	for _, l := range labels {
+		f.path += fmt.Sprintf(":%v", l)
+	}
+
+	return f
+}
+
+// Intn returns number in range of [0, n) for the label.
+// Numbers out of the biggest multiple of n are rejected to avoid modulo bias.
+func (f Fair) Intn(n int, label string) int {
+	limit := ^uint64(0) - ^uint64(0)%uint64(n)
+	for attempt := 0; ; attempt++ {
+		mac := hmac.New(sha256.New, []byte(f.serverSeed))
+		fmt.Fprintf(mac, "%s%s:%s:%d", f.clientSeed, f.path, label, attempt)
+		if value := binary.BigEndian.Uint64(mac.Sum(nil)[:8]); value < limit {
+			return int(value % uint64(n))
+		}
+	}
+}
+
+// Shuffle shuffles n elements by Fisher-Yates algorithm.
+func (f Fair) Shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, f.Intn(i+1, fmt.Sprintf("shuffle%d", i)))
+	}
+}
+
+// newSeed returns random hex encoded server seed.
+func newSeed() (string, error) {
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(seed), nil
+}
+
+// hashSeed returns hex encoded SHA-256 of the seed published before the game.
+func hashSeed(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// clientSeed returns client seed of the game made of its ID and seeds of the participants.
+// Players set their seeds after the server seed hash is published,
+// so the client seed isn't known to the operator when the server seed is fixed.
+func clientSeed(gameID uint64, players []int64, seeds KVStore) string {
+	parts := []string{}
+	for _, id := range sortedPlayers(players) {
+		parts = append(parts, fmt.Sprintf("%d=%s", id, seeds.Get(strconv.FormatInt(id, 10))))
+	}
+
+	return fmt.Sprintf("%d:%s", gameID, strings.Join(parts, ","))
+}
+
+// sortedPlayers returns copy of the players ordered by ID,
+// so shuffles start from the same order every time.
+func sortedPlayers(players []int64) []int64 {
+	sorted := append([]int64{}, players...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return sorted
+}
+
+// bracket returns pairs of the round followed by players passing it by byes.
+// Players are sorted, then shuffled by the source of randomness of the round.
+func bracket(players []int64, fair Fair) ([][2]int64, []int64) {
+	players = sortedPlayers(players)
+	fair.Shuffle(len(players), func(i, j int) { players[i], players[j] = players[j], players[i] })
+	paired := len(players) - byesCount(len(players))
+
+	pairs := [][2]int64{}
+	for i := 0; i < paired; i += 2 {
+		pairs = append(pairs, [2]int64{players[i], players[i+1]})
+	}
+
+	return pairs, players[paired:]
+}
+
+// autoMove picks move for the player who didn't make it.
+func autoMove(rules RuleSet, fair Fair, side string) byte {
+	return rules.Moves()[fair.Intn(len(rules.Moves()), "auto"+side)].Code
+}
+
+// coinFlip picks winner of the draw which can't be replayed.
+func coinFlip(fair Fair, playerA, playerB int64) int64 {
+	if fair.Intn(2, "flip") == 1 {
+		return playerB
+	}
+
+	return playerA
+}
+
+// VerifyGame recomputes pairings, automatic moves, coin flips and winners of the game
+// from its revealed seed and checks them against the record.
+// Returns list of mismatches, the empty one means the game is fair.
+func VerifyGame(game *GameRecord) []string {
+	problems := []string{}
+	if game.ServerSeed == "" {
+		return append(problems, "the game was played without a seed")
+	}
+	if hashSeed(game.ServerSeed) != game.ServerSeedHash {
+		problems = append(problems, "server seed doesn't match its hash")
+	}
+	rules, err := FindRuleSet(game.Rules)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+
+	fair := NewFair(game.ServerSeed, game.ClientSeed)
+	players := []int64{}
+	for _, p := range game.Participants {
+		players = append(players, p.UserID)
+	}
+
+	for _, r := range game.Rounds {
+		roundFair := fair.Sub("round", r.Number)
+		pairs, byes := bracket(players, roundFair)
+		expected := append([][2]int64{}, pairs...)
+		for _, id := range byes {
+			expected = append(expected, [2]int64{id, -1})
+		}
+		if len(expected) != len(r.Matches) {
+			problems = append(problems, fmt.Sprintf("round %d: %d matches expected, %d played",
+				r.Number, len(expected), len(r.Matches)))
+			return problems
+		}
+
+		players = []int64{}
+		for i, m := range r.Matches {
+			if m.PlayerA != expected[i][0] || m.PlayerB != expected[i][1] {
+				problems = append(problems, fmt.Sprintf("round %d match %d: pairing differs", r.Number, i+1))
+			}
+			players = append(players, m.Winner)
+			if m.PlayerB == -1 {
+				continue
+			}
+			problems = append(problems, verifyMatch(m, rules, roundFair.Sub("match", i),
+				fmt.Sprintf("round %d match %d", r.Number, i+1))...)
+		}
+	}
+
+	if game.Finished() && (len(players) != 1 || players[0] != game.Winner) {
+		problems = append(problems, "final winner differs")
+	}
+
+	return problems
+}
+
+// verifyMatch checks throws of the match and its winner.
+func verifyMatch(m MatchRecord, rules RuleSet, fair Fair, name string) []string {
+	problems := []string{}
+	wins := map[int64]int{}
+	for k, t := range m.Throws {
+		throwFair := fair.Sub("throw", k)
+		throwName := fmt.Sprintf("%s throw %d", name, k+1)
+		if !VerifyThrow(t, m.PlayerA, m.PlayerB) {
+			problems = append(problems, throwName+": commitment doesn't match the move")
+		}
+		if t.AutoA && t.MoveA != string(autoMove(rules, throwFair, "A")) ||
+			t.AutoB && t.MoveB != string(autoMove(rules, throwFair, "B")) {
+			problems = append(problems, throwName+": automatic move differs")
+		}
+
+		resolved := ThrowRecord{MoveA: t.MoveA, MoveB: t.MoveB}
+		resolveThrow(&resolved, m.PlayerA, m.PlayerB, rules, throwFair, !t.CoinFlip)
+		if resolved.Winner != t.Winner {
+			problems = append(problems, throwName+": winner differs")
+		}
+		wins[t.Winner]++
+	}
+
+	winner := m.PlayerA
+	if wins[m.PlayerB] > wins[m.PlayerA] {
+		winner = m.PlayerB
+	}
+	if winner != m.Winner {
+		problems = append(problems, name+": winner differs")
+	}
+
+	return problems
+}
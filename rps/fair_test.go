@@ -0,0 +1,80 @@
+package rps
+
+import (
+	"fmt"
+	"testing"
+)
+
+// newSeedTestBot returns bot of the registered players having the vaults of the game record.
+func newSeedTestBot(t *testing.T, players ...int64) *Bot {
+	t.Helper()
+	storage := openTestStorage(t)
+	users := NewUsers("users", storage)
+	for _, id := range players {
+		user := NewUser(id, fmt.Sprintf("user%d", id), true, false, true, 0)
+		if err := users.Put(id, &user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	games := NewGames("games", storage)
+	opts := &Options{ticketPrice: 0.001, prizeStrategy: NewProgressiveRefund(0.001),
+		bestOf: 1, roundTime: 10, drawTimeout: 30, rules: ClassicRules()}
+
+	return &Bot{opts: opts, storage: storage, users: &users, stats: storage.KV("stats"),
+		seeds: storage.KV("seeds"), games: &games, players: players}
+}
+
+func TestClientSeed(t *testing.T) {
+	seeds := openTestStorage(t).KV("seeds")
+	before := clientSeed(7, []int64{3, 1, 2}, seeds)
+	if before != "7:1=,2=,3=" {
+		t.Errorf("client seed without seeds of the players is %q", before)
+	}
+
+	if err := seeds.Put("2", "lucky-42"); err != nil {
+		t.Fatal(err)
+	}
+	if seed := clientSeed(7, []int64{3, 1, 2}, seeds); seed != "7:1=,2=lucky-42,3=" {
+		t.Errorf("client seed with seed of the player is %q", seed)
+	}
+}
+
+func TestPlayerSeedFormat(t *testing.T) {
+	for _, seed := range []string{"a", "lucky-42", "A_b-C", "0123456789012345678901234567890123456789012345678901234567890123"} {
+		if !playerSeedFormat.MatchString(seed) {
+			t.Errorf("seed %q isn't accepted", seed)
+		}
+	}
+	for _, seed := range []string{"", "a,b", "a=b", "a b", "01234567890123456789012345678901234567890123456789012345678901234"} {
+		if playerSeedFormat.MatchString(seed) {
+			t.Errorf("seed %q is accepted", seed)
+		}
+	}
+}
+
+func TestStartGameRecordNeedsPublishedSeed(t *testing.T) {
+	b := newSeedTestBot(t, 1, 2)
+	if err := b.startGameRecord(false); err == nil {
+		t.Fatal("game is started by the seed which hash isn't published")
+	}
+	if b.stats.Get("currentGame") != "" {
+		t.Error("record of the game without published seed is saved")
+	}
+
+	hash := b.nextSeedHash()
+	if err := b.seeds.Put("2", "lucky-42"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.startGameRecord(false); err != nil {
+		t.Fatal(err)
+	}
+	if b.game.ServerSeedHash != hash {
+		t.Errorf("game is played by the seed of hash %s, %s is published", b.game.ServerSeedHash, hash)
+	}
+	if b.game.ClientSeed != fmt.Sprintf("%d:1=,2=lucky-42", b.game.GameID) {
+		t.Errorf("client seed of the game is %q", b.game.ClientSeed)
+	}
+	if next := b.nextSeedHash(); next == hash || next == "" {
+		t.Error("seed of the next game isn't changed")
+	}
+}
@@ -0,0 +1,255 @@
+package rps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// fakeAddresses maps request addresses of all fake wallets to their owners,
+// so paying to an address of a fake request credits the receiving wallet.
+var fakeAddresses = NewSynMap()
+
+var fakeAddressCounter uint64
+var fakeAddressLock sync.Mutex
+
+var fakeTxCounter uint64
+
+type fakeRequest struct {
+	amount float64
+	status string
+}
+
+// FakeWallet structure.
+// Implements Wallet in memory, intended for testing without electron-cash.
+type FakeWallet struct {
+	balance  float64
+	requests map[string]*fakeRequest
+	order    []string
+	payouts  map[string][]float64
+	payErr   error
+	lock     *sync.RWMutex
+}
+
+// NewFakeWallet creates an object of FakeWallet structure with initial balance.
+func NewFakeWallet(balance float64) *FakeWallet {
+	lock := sync.RWMutex{}
+	requests := map[string]*fakeRequest{}
+	payouts := map[string][]float64{}
+
+	return &FakeWallet{balance, requests, []string{}, payouts, nil, &lock}
+}
+
+func newFakeAddress() string {
+	fakeAddressLock.Lock()
+	defer fakeAddressLock.Unlock()
+	fakeAddressCounter++
+
+	// Keep the cash address format so fake addresses pass WalletValidate
+	return fmt.Sprintf("bchtest:qfake%037d", fakeAddressCounter)
+}
+
+func newFakeTxID() string {
+	fakeAddressLock.Lock()
+	defer fakeAddressLock.Unlock()
+	fakeTxCounter++
+
+	return fmt.Sprintf("%064x", fakeTxCounter)
+}
+
+// GetBalance returns current balance of the wallet.
+func (w *FakeWallet) GetBalance() (float64, error) {
+	(*w.lock).RLock()
+	defer (*w.lock).RUnlock()
+	return w.balance, nil
+}
+
+// GetRequest returns request's metadata in the same shape electron-cash does.
+func (w *FakeWallet) GetRequest(requestID string) (map[string]json.RawMessage, error) {
+	(*w.lock).RLock()
+	defer (*w.lock).RUnlock()
+
+	request, ok := w.requests[requestID]
+	if !ok {
+		return map[string]json.RawMessage{}, errors.New("getrequest: unknown request")
+	}
+
+	address, _ := json.Marshal(requestID)
+	amount, _ := json.Marshal(request.amount)
+	status, _ := json.Marshal(request.status)
+
+	return map[string]json.RawMessage{
+		"address": address,
+		"amount":  amount,
+		"status":  status,
+	}, nil
+}
+
+// PayTo performs pay to specified address and returns ID of the transaction.
+// If the address belongs to a request of another fake wallet,
+// that wallet is credited and the request is marked as paid.
+func (w *FakeWallet) PayTo(dstAddress string, amount float64) (string, error) {
+	(*w.lock).Lock()
+	if w.payErr != nil {
+		(*w.lock).Unlock()
+		return "", w.payErr
+	}
+	if amount == -1 {
+		amount = w.balance
+	}
+	if amount > w.balance {
+		(*w.lock).Unlock()
+		return "", errors.New("payto: insufficient funds")
+	}
+	w.balance -= amount
+	w.payouts[dstAddress] = append(w.payouts[dstAddress], amount)
+	(*w.lock).Unlock()
+
+	if dst, ok := fakeAddresses.Get(dstAddress).(*FakeWallet); ok {
+		dst.receive(dstAddress, amount)
+	}
+
+	return newFakeTxID(), nil
+}
+
+// CreateRequest creates payment request and returns its address and URI.
+func (w *FakeWallet) CreateRequest(amount float64) (string, string, error) {
+	(*w.lock).Lock()
+	defer (*w.lock).Unlock()
+
+	address := newFakeAddress()
+	w.requests[address] = &fakeRequest{amount, "Pending"}
+	w.order = append(w.order, address)
+	fakeAddresses.Put(address, w)
+
+	return address, fmt.Sprintf("%s?amount=%f", address, amount), nil
+}
+
+// RemoveRequest removes payment request.
+func (w *FakeWallet) RemoveRequest(requestID string) error {
+	(*w.lock).Lock()
+	defer (*w.lock).Unlock()
+
+	if _, ok := w.requests[requestID]; !ok {
+		return errors.New("rmrequest return false")
+	}
+	w.removeRequest(requestID)
+
+	return nil
+}
+
+// ClearRequests removes all active requests.
+func (w *FakeWallet) ClearRequests() error {
+	(*w.lock).Lock()
+	defer (*w.lock).Unlock()
+
+	for address := range w.requests {
+		fakeAddresses.Delete(address)
+	}
+	w.requests = map[string]*fakeRequest{}
+	w.order = []string{}
+
+	return nil
+}
+
+// MarkPaid sets status of the request to "Paid" and credits the wallet.
+// Request is paid only once, marking a paid one again changes nothing.
+func (w *FakeWallet) MarkPaid(requestID string) error {
+	(*w.lock).Lock()
+	defer (*w.lock).Unlock()
+
+	request, ok := w.requests[requestID]
+	if !ok {
+		return errors.New("markpaid: unknown request")
+	}
+	if request.status != "Paid" {
+		w.balance += request.amount
+		request.status = "Paid"
+	}
+
+	return nil
+}
+
+// Deposit adds funds to the wallet bypassing any request.
+func (w *FakeWallet) Deposit(amount float64) {
+	(*w.lock).Lock()
+	defer (*w.lock).Unlock()
+	w.balance += amount
+}
+
+// SetPayToError makes every following PayTo fail with err.
+// Passing nil makes PayTo succeed again.
+func (w *FakeWallet) SetPayToError(err error) {
+	(*w.lock).Lock()
+	defer (*w.lock).Unlock()
+	w.payErr = err
+}
+
+// Requests returns addresses of active requests in order of creation.
+func (w *FakeWallet) Requests() []string {
+	(*w.lock).RLock()
+	defer (*w.lock).RUnlock()
+
+	lst := make([]string, len(w.order))
+	copy(lst, w.order)
+
+	return lst
+}
+
+// RequestStatus returns status of the request or empty string if there is no such one.
+func (w *FakeWallet) RequestStatus(requestID string) string {
+	(*w.lock).RLock()
+	defer (*w.lock).RUnlock()
+
+	if request, ok := w.requests[requestID]; ok {
+		return request.status
+	}
+
+	return ""
+}
+
+// Payouts returns every amount sent to the address in order of sending.
+func (w *FakeWallet) Payouts(address string) []float64 {
+	(*w.lock).RLock()
+	defer (*w.lock).RUnlock()
+
+	lst := make([]float64, len(w.payouts[address]))
+	copy(lst, w.payouts[address])
+
+	return lst
+}
+
+// AllPayouts returns every amount sent by the wallet grouped by address.
+func (w *FakeWallet) AllPayouts() map[string][]float64 {
+	(*w.lock).RLock()
+	defer (*w.lock).RUnlock()
+
+	payouts := make(map[string][]float64, len(w.payouts))
+	for address, amounts := range w.payouts {
+		payouts[address] = append([]float64{}, amounts...)
+	}
+
+	return payouts
+}
+
+func (w *FakeWallet) receive(requestID string, amount float64) {
+	(*w.lock).Lock()
+	defer (*w.lock).Unlock()
+
+	w.balance += amount
+	if request, ok := w.requests[requestID]; ok {
+		request.status = "Paid"
+	}
+}
+
+func (w *FakeWallet) removeRequest(requestID string) {
+	delete(w.requests, requestID)
+	fakeAddresses.Delete(requestID)
+	for i, address := range w.order {
+		if address == requestID {
+			w.order = append(w.order[:i], w.order[i+1:]...)
+			break
+		}
+	}
+}
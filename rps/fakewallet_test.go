@@ -0,0 +1,51 @@
+package rps
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFakeWallet(t *testing.T) {
+	cashbox, bank := NewFakeWallet(0), NewFakeWallet(0)
+	bank.Deposit(0.01)
+	if status := cashbox.RequestStatus("unknown"); status != "" {
+		t.Errorf("unknown request is %q", status)
+	}
+
+	// Paying to a request of another fake wallet credits it
+	address, _, err := cashbox.CreateRequest(0.004)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.PayTo(address, 0.004); err != nil {
+		t.Fatal(err)
+	}
+	if status := cashbox.RequestStatus(address); status != "Paid" {
+		t.Errorf("request paid by another wallet is %q", status)
+	}
+	if balance, _ := cashbox.GetBalance(); balance != 0.004 {
+		t.Errorf("cashbox got %f", balance)
+	}
+
+	// Failing wallet sends nothing until it's fixed
+	bank.SetPayToError(errors.New("network down"))
+	if _, err := bank.PayTo("bchtest:qother", 0.001); err == nil {
+		t.Error("failing wallet paid")
+	}
+	bank.SetPayToError(nil)
+	if _, err := bank.PayTo("bchtest:qother", 0.001); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.PayTo("bchtest:qother", 1); err == nil {
+		t.Error("wallet paid more than its balance")
+	}
+
+	all := bank.AllPayouts()
+	if len(all) != 2 || len(all[address]) != 1 || len(all["bchtest:qother"]) != 1 {
+		t.Errorf("payouts are %v", all)
+	}
+	all["bchtest:qother"][0] = 1
+	if payouts := bank.Payouts("bchtest:qother"); payouts[0] != 0.001 {
+		t.Errorf("payouts are changed through their copy: %v", payouts)
+	}
+}
@@ -0,0 +1,334 @@
+package rps
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Participant structure.
+// Keeps the name a player had at the moment of the game.
+type Participant struct {
+	UserID int64  `json:"userID"`
+	Name   string `json:"name"`
+}
+
+// ThrowRecord structure.
+// Keeps moves of a single exchange of a match.
+// Winner equal to 0 means the throw was a draw and has been replayed.
+// Times of the moves are server-side, nonces reveal the commitments of the moves.
+type ThrowRecord struct {
+	MoveA    string    `json:"moveA"`
+	MoveB    string    `json:"moveB"`
+	AutoA    bool      `json:"autoA"`
+	AutoB    bool      `json:"autoB"`
+	CoinFlip bool      `json:"coinFlip"`
+	Winner   int64     `json:"winner"`
+	TimeA    time.Time `json:"timeA"`
+	TimeB    time.Time `json:"timeB"`
+	NonceA   string    `json:"nonceA"`
+	NonceB   string    `json:"nonceB"`
+	CommitA  string    `json:"commitA"`
+	CommitB  string    `json:"commitB"`
+}
+
+// MatchRecord structure.
+// Keeps pairing, moves and result of a single match of a round.
+// PlayerB equal to -1 means PlayerA had no opponent and passed the round.
+// Moves of the last throw are kept apart from the throws,
+// so records made before matches of several throws are read the same way.
+type MatchRecord struct {
+	PlayerA  int64         `json:"playerA"`
+	PlayerB  int64         `json:"playerB"`
+	MoveA    string        `json:"moveA"`
+	MoveB    string        `json:"moveB"`
+	AutoA    bool          `json:"autoA"`
+	AutoB    bool          `json:"autoB"`
+	CoinFlip bool          `json:"coinFlip"`
+	Throws   []ThrowRecord `json:"throws"`
+	Winner   int64         `json:"winner"`
+	Loser    int64         `json:"loser"`
+}
+
+// ThrowList returns throws of the match, a single one for records made before throws were kept.
+func (m *MatchRecord) ThrowList() []ThrowRecord {
+	if len(m.Throws) > 0 {
+		return m.Throws
+	}
+
+	return []ThrowRecord{{MoveA: m.MoveA, MoveB: m.MoveB, AutoA: m.AutoA, AutoB: m.AutoB,
+		CoinFlip: m.CoinFlip, Winner: m.Winner}}
+}
+
+// RoundRecord structure.
+type RoundRecord struct {
+	Number  int           `json:"number"`
+	Matches []MatchRecord `json:"matches"`
+}
+
+// PayoutRecord structure.
+// Error is set if the first attempt of the payout failed, TxID is empty in that case.
+// Further attempts are tracked by the ledger entry.
+type PayoutRecord struct {
+	UserID   int64     `json:"userID"`
+	Address  string    `json:"address"`
+	Amount   float64   `json:"amount"`
+	TxID     string    `json:"txID"`
+	Error    string    `json:"error"`
+	Date     time.Time `json:"date"`
+	LedgerID uint64    `json:"ledgerID"`
+}
+
+// GameRecord structure.
+// Keeps the whole history of a game to audit it afterwards.
+// Pot is the amount prizes of the game are paid from, it's made of the tickets
+// of the game except the house fee and the jackpot rolled over from the previous games.
+// Unpaid rest of the pot is rolled over to the jackpot when the game is over.
+// Match format and prize distribution are kept as the game started,
+// so it's played and replayed by them whatever the options are now.
+type GameRecord struct {
+	GameID         uint64         `json:"gameID"`
+	Rules          string         `json:"rules"`
+	BestOf         uint           `json:"bestOf"`
+	RoundTime      uint           `json:"roundTime"`
+	DrawTimeout    uint           `json:"drawTimeout"`
+	TicketPrice    float64        `json:"ticketPrice"`
+	PrizeStrategy  string         `json:"prizeStrategy"`
+	ServerSeed     string         `json:"serverSeed"`
+	ServerSeedHash string         `json:"serverSeedHash"`
+	ClientSeed     string         `json:"clientSeed"`
+	Pot            float64        `json:"pot"`
+	TicketsAmount  float64        `json:"ticketsAmount"`
+	Fee            float64        `json:"fee"`
+	Jackpot        float64        `json:"jackpot"`
+	RolledOver     float64        `json:"rolledOver"`
+	StartTime      time.Time      `json:"startTime"`
+	EndTime        time.Time      `json:"endTime"`
+	Participants   []Participant  `json:"participants"`
+	Rounds         []RoundRecord  `json:"rounds"`
+	Winner         int64          `json:"winner"`
+	Payouts        []PayoutRecord `json:"payouts"`
+}
+
+// NewGameRecord creates an object of GameRecord structure.
+func NewGameRecord(
+	gameID uint64,
+	opts *Options,
+	ticketsAmount float64,
+	fee float64,
+	jackpot float64,
+	players []int64,
+	users *Users,
+) GameRecord {
+	participants := []Participant{}
+	for _, id := range players {
+		participants = append(participants, Participant{id, users.Get(id).GetName()})
+	}
+
+	// Seeds are set when the game starts
+	return GameRecord{gameID, opts.rules.Name(), opts.bestOf, opts.roundTime, opts.drawTimeout,
+		opts.ticketPrice, opts.prizeStrategy.Name(), "", "", "",
+		ticketsAmount - fee + jackpot, ticketsAmount, fee, jackpot, 0,
+		time.Now(), time.Time{}, participants, []RoundRecord{}, 0, []PayoutRecord{}}
+}
+
+// Fair returns source of randomness of the game.
+func (g *GameRecord) Fair() Fair {
+	return NewFair(g.ServerSeed, g.ClientSeed)
+}
+
+// Options returns the options with the rules, match format and prize distribution of the game.
+// Games recorded before they were kept take the ones missing from opts.
+func (g *GameRecord) Options(opts *Options) (Options, error) {
+	recorded := *opts
+	var err error
+	if recorded.rules, err = FindRuleSet(g.Rules); err != nil {
+		return recorded, err
+	}
+	if g.BestOf == 0 {
+		return recorded, nil
+	}
+
+	recorded.bestOf, recorded.roundTime, recorded.drawTimeout, recorded.ticketPrice =
+		g.BestOf, g.RoundTime, g.DrawTimeout, g.TicketPrice
+	recorded.prizeStrategy, err = ParsePrizeStrategy(g.PrizeStrategy, g.TicketPrice)
+
+	return recorded, err
+}
+
+// ParticipantName returns name of the participant or empty string if there is no such one.
+func (g *GameRecord) ParticipantName(uid int64) string {
+	for _, p := range g.Participants {
+		if p.UserID == uid {
+			return p.Name
+		}
+	}
+
+	return ""
+}
+
+// WonAmount returns sum of the payouts to the participant.
+func (g *GameRecord) WonAmount(uid int64) float64 {
+	amount := 0.0
+	for _, p := range g.Payouts {
+		if p.UserID == uid {
+			amount += p.Amount
+		}
+	}
+
+	return amount
+}
+
+// Paid returns sum of all the payouts of the game.
+func (g *GameRecord) Paid() float64 {
+	amount := 0.0
+	for _, p := range g.Payouts {
+		amount += p.Amount
+	}
+
+	return amount
+}
+
+// Unpaid returns the rest of the pot.
+func (g *GameRecord) Unpaid() float64 {
+	return MaxFloat64(g.Pot-g.Paid(), 0)
+}
+
+// Wins returns number of matches won by the participant, byes aren't counted.
+func (g *GameRecord) Wins(uid int64) int {
+	wins := 0
+	for _, r := range g.Rounds {
+		for _, m := range r.Matches {
+			if m.Winner == uid && m.Loser != -1 {
+				wins++
+			}
+		}
+	}
+
+	return wins
+}
+
+// Place returns place of the participant finished the game in the round.
+func (g *GameRecord) Place(uid int64, round int) Place {
+	return Place{len(g.Participants), round, g.Wins(uid)}
+}
+
+// Prize returns amount won at the place, it never exceeds the unpaid rest of the pot.
+func (g *GameRecord) Prize(strategy PrizeStrategy, place Place) float64 {
+	return clampPrize(strategy.Prize(place, g.Pot), g.Pot, g.Paid())
+}
+
+// Finished checks if the game is over.
+func (g *GameRecord) Finished() bool {
+	return !g.EndTime.IsZero()
+}
+
+// Games structure.
+// Vault of game records keyed by game ID.
+type Games struct {
+	data KVStore
+}
+
+// NewGames creates an object of Games structure.
+func NewGames(name string, storage Storage) Games {
+	data := storage.KV(name)
+
+	return Games{data}
+}
+
+// gameKey returns key of the game record, zero padded to keep keys ordered.
+func gameKey(gameID uint64) string {
+	return fmt.Sprintf("%020d", gameID)
+}
+
+// Get returns record of the game.
+func (g Games) Get(gameID uint64) (GameRecord, error) {
+	var record GameRecord
+	value := g.data.Get(gameKey(gameID))
+	if value == "" {
+		return record, fmt.Errorf("there is no game with ID %d", gameID)
+	}
+	err := json.Unmarshal([]byte(value), &record)
+
+	return record, err
+}
+
+// Put saves record of the game.
+func (g Games) Put(record *GameRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return g.data.Put(gameKey(record.GameID), string(value))
+}
+
+// TxPut saves record of the game as a part of the transaction.
+func (g Games) TxPut(tx *Tx, record *GameRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	g.data.TxPut(tx, gameKey(record.GameID), string(value))
+
+	return nil
+}
+
+// List returns all the game records ordered by game ID.
+func (g Games) List() []GameRecord {
+	records := []GameRecord{}
+	for k, v := range g.data.Iterate() {
+		var record GameRecord
+		if err := json.Unmarshal([]byte(v), &record); err != nil {
+			Error.Printf("Can't deserialize game record:\n\tKey: %s\n\t%s", k, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].GameID < records[j].GameID })
+
+	return records
+}
+
+// ForUser returns up to n finished games the user took part in, the most recent first.
+func (g Games) ForUser(uid int64, n int) []GameRecord {
+	records := g.List()
+	lst := []GameRecord{}
+	for i := len(records) - 1; i >= 0 && len(lst) < n; i-- {
+		for _, p := range records[i].Participants {
+			if p.UserID == uid && records[i].Finished() {
+				lst = append(lst, records[i])
+				break
+			}
+		}
+	}
+
+	return lst
+}
+
+// Len returns number of stored games.
+func (g Games) Len() int {
+	return g.data.Len()
+}
+
+// getJackpot returns amount rolled over from the previous games.
+func getJackpot(stats KVStore) float64 {
+	value := stats.Get("jackpot")
+	if value == "" {
+		return 0
+	}
+	jackpot, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		Error.Printf("Can't parse the jackpot:\n\tValue: %s\n\t%s", value, err)
+		return 0
+	}
+
+	return jackpot
+}
+
+// txPutJackpot sets amount of the jackpot as a part of the transaction.
+func txPutJackpot(tx *Tx, stats KVStore, jackpot float64) {
+	stats.TxPut(tx, "jackpot", strconv.FormatFloat(jackpot, 'f', 8, 64))
+}
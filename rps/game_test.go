@@ -0,0 +1,63 @@
+package rps
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestGamesListWhileSaving(t *testing.T) {
+	games := NewGames("games", openTestStorage(t))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := uint64(1); i <= 100; i++ {
+			record := GameRecord{GameID: i}
+			if err := games.Put(&record); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			games.List()
+			games.ForUser(1, historySize)
+		}
+	}()
+	wg.Wait()
+
+	if n := len(games.List()); n != 100 {
+		t.Errorf("%d games listed, 100 expected", n)
+	}
+}
+
+func TestGameRecordOptions(t *testing.T) {
+	strategy, _ := ParsePrizeStrategy("top:2", 0.002)
+	played := Options{roundTime: 15, ticketPrice: 0.002, prizeStrategy: strategy,
+		bestOf: 3, drawTimeout: 45, rules: RPSLSRules()}
+	record := GameRecord{Rules: played.rules.Name(), BestOf: played.bestOf, RoundTime: played.roundTime,
+		DrawTimeout: played.drawTimeout, TicketPrice: played.ticketPrice, PrizeStrategy: strategy.Name()}
+
+	current := Options{roundTime: 10, ticketPrice: 0.001, prizeStrategy: NewWinnerTakesAll(),
+		bestOf: 1, drawTimeout: 30, rules: ClassicRules()}
+	opts, err := record.Options(&current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.bestOf != 3 || opts.roundTime != 15 || opts.drawTimeout != 45 || opts.ticketPrice != 0.002 ||
+		opts.prizeStrategy.Name() != "top:2" || opts.rules.Name() != played.rules.Name() {
+		t.Errorf("options of the game aren't taken from the record: %+v", opts)
+	}
+
+	// Records made before the format was kept are played by the current options
+	legacy := GameRecord{}
+	if opts, err = legacy.Options(&current); err != nil {
+		t.Fatal(err)
+	}
+	if opts.bestOf != 1 || opts.prizeStrategy.Name() != "winner" || opts.rules.Name() != ClassicRules().Name() {
+		t.Errorf("options of the legacy game aren't the current ones: %+v", opts)
+	}
+}
@@ -1,7 +1,6 @@
 package rps
 
 import (
-	"path/filepath"
 	"sync"
 
 	"github.com/syndtr/goleveldb/leveldb"
@@ -12,28 +11,25 @@ type LDBMap struct {
 	data  map[string]string
 	lock  *sync.RWMutex
 	name  string
-	db    *leveldb.DB
+	db    DB
 	batch *leveldb.Batch
 }
 
 // NewLDBMap creates an object of NewLDBMap structure.
-func NewLDBMap(name string, dbPath string) LDBMap {
+// Name is the namespace of the vault in the database.
+func NewLDBMap(name string, db DB) LDBMap {
 	lock := sync.RWMutex{}
 	data := map[string]string{}
-	db, err := leveldb.OpenFile(filepath.Join(dbPath, name), nil)
+
+	err := db.namespaceIterate(name, func(k []byte, v []byte) {
+		data[string(k)] = string(v)
+	})
 	if err != nil {
-		Error.Printf("Can't get access to database:\n\tDBPath: %s",
-			filepath.Join(dbPath, name))
+		Error.Printf("Can't load vault from database:\n\tDBPath: %s\n\tName: %s",
+			db.path, name)
 		panic(err)
 	}
 
-	iter := db.NewIterator(nil, nil)
-	for iter.Next() {
-		k, v := iter.Key(), iter.Value()
-		sk, sv := string(k), string(v)
-		data[sk] = sv
-	}
-
 	batch := new(leveldb.Batch)
 	ldbMap := LDBMap{data, &lock, name, db, batch}
 
@@ -52,7 +48,7 @@ func (m LDBMap) Put(key string, value string) error {
 	(*m.lock).Lock()
 	defer (*m.lock).Unlock()
 
-	err := m.db.Put([]byte(key), []byte(value), nil)
+	err := m.db.ldb.Put(namespaceKey(m.name, key), []byte(value), nil)
 	if err != nil {
 		return err
 	}
@@ -66,7 +62,7 @@ func (m LDBMap) Delete(key string) error {
 	(*m.lock).Lock()
 	defer (*m.lock).Unlock()
 
-	err := m.db.Delete([]byte(key), nil)
+	err := m.db.ldb.Delete(namespaceKey(m.name, key), nil)
 	if err != nil {
 		return err
 	}
@@ -85,12 +81,30 @@ func (m LDBMap) Exist(key string) bool {
 	return ok
 }
 
+// TxPut puts an object into the vault as a part of the transaction.
+func (m LDBMap) TxPut(tx *Tx, key string, value string) {
+	tx.put(txOp{namespace: m.name, key: key, value: []byte(value)}, func() {
+		(*m.lock).Lock()
+		defer (*m.lock).Unlock()
+		m.data[key] = value
+	})
+}
+
+// TxDelete deletes an object from the vault as a part of the transaction.
+func (m LDBMap) TxDelete(tx *Tx, key string) {
+	tx.delete(txOp{namespace: m.name, key: key}, func() {
+		(*m.lock).Lock()
+		defer (*m.lock).Unlock()
+		delete(m.data, key)
+	})
+}
+
 // BatchPut puts an object into the vault by batching (leveldb).
 func (m LDBMap) BatchPut(key string, value string) {
 	(*m.lock).Lock()
 	defer (*m.lock).Unlock()
 
-	m.batch.Put([]byte(key), []byte(value))
+	m.batch.Put(namespaceKey(m.name, key), []byte(value))
 }
 
 // BatchDelete deletes an object from the vault by batching (leveldb).
@@ -98,27 +112,37 @@ func (m LDBMap) BatchDelete(key string) {
 	(*m.lock).Lock()
 	defer (*m.lock).Unlock()
 
-	m.batch.Delete([]byte(key))
+	m.batch.Delete(namespaceKey(m.name, key))
 }
 
 // BatchWrite performs write of the batch to the database.
 func (m LDBMap) BatchWrite() error {
-	err := m.db.Write(m.batch, nil)
+	(*m.lock).Lock()
+	defer (*m.lock).Unlock()
+
+	err := m.db.ldb.Write(m.batch, nil)
+	m.batch.Reset()
 
 	return err
 }
 
 // Iterate brings possibility to iterate over the vault.
+// Returns a copy taken under the lock, so the vault can be changed while it's iterated.
 func (m LDBMap) Iterate() map[string]string {
-	return m.data
+	(*m.lock).RLock()
+	defer (*m.lock).RUnlock()
+
+	data := make(map[string]string, len(m.data))
+	for k, v := range m.data {
+		data[k] = v
+	}
+
+	return data
 }
 
 // Len returns length of the vault
 func (m LDBMap) Len() int {
+	(*m.lock).RLock()
+	defer (*m.lock).RUnlock()
 	return len(m.data)
 }
-
-// Close closes the database.
-func (m LDBMap) Close() {
-	m.db.Close()
-}
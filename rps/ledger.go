@@ -0,0 +1,161 @@
+package rps
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Statuses of the payouts.
+const (
+	// PayoutPending is a payout which is being sent right now.
+	// Pending payouts left after a restart need a manual check,
+	// because the transaction could have been broadcasted.
+	PayoutPending = "pending"
+	// PayoutSent is a payout with a broadcasted transaction.
+	PayoutSent = "sent"
+	// PayoutFailed is a payout waiting for the next attempt.
+	PayoutFailed = "failed"
+	// PayoutOwed is a payout held until the user sets a wallet address.
+	// Not created anymore, such payouts are credited to the balance of the user.
+	PayoutOwed = "owed"
+	// PayoutCredited is a payout credited to the internal balance of the user.
+	PayoutCredited = "credited"
+)
+
+// Bounds of the delay between attempts of a failed payout.
+const (
+	minPayoutBackoff = time.Minute
+	maxPayoutBackoff = 6 * time.Hour
+)
+
+// LedgerEntry structure.
+// GameID equal to 0 means withdrawal of the user's balance.
+// UserID equal to 0 means the house fee of the game sent to the operator.
+type LedgerEntry struct {
+	ID          uint64    `json:"id"`
+	GameID      uint64    `json:"gameID"`
+	UserID      int64     `json:"userID"`
+	Address     string    `json:"address"`
+	Amount      float64   `json:"amount"`
+	Status      string    `json:"status"`
+	TxID        string    `json:"txID"`
+	Error       string    `json:"error"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+}
+
+// Ledger structure.
+// Durable journal of all the payouts made by the bank.
+type Ledger struct {
+	data  KVStore
+	stats KVStore
+	lock  *sync.Mutex
+}
+
+// NewLedger creates an object of Ledger structure.
+// Counter of the entries is kept in stats.
+func NewLedger(name string, storage Storage, stats KVStore) Ledger {
+	lock := sync.Mutex{}
+	data := storage.KV(name)
+
+	return Ledger{data, stats, &lock}
+}
+
+// ledgerKey returns key of the entry, zero padded to keep keys ordered.
+func ledgerKey(id uint64) string {
+	return fmt.Sprintf("%020d", id)
+}
+
+// Add assigns ID to the entry and saves it.
+func (l Ledger) Add(entry *LedgerEntry) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	id, err := nextCounter(l.stats, "lastPayoutID")
+	if err != nil {
+		return err
+	}
+	entry.ID = id
+	entry.Created = time.Now()
+
+	return l.put(entry)
+}
+
+// Put updates the entry.
+func (l Ledger) Put(entry *LedgerEntry) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.put(entry)
+}
+
+func (l Ledger) put(entry *LedgerEntry) error {
+	entry.Updated = time.Now()
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return l.data.Put(ledgerKey(entry.ID), string(value))
+}
+
+// List returns entries matching fn ordered by ID.
+func (l Ledger) List(fn func(e *LedgerEntry) bool) []LedgerEntry {
+	entries := []LedgerEntry{}
+	for k, v := range l.data.Iterate() {
+		var entry LedgerEntry
+		if err := json.Unmarshal([]byte(v), &entry); err != nil {
+			Error.Printf("Can't deserialize ledger entry:\n\tKey: %s\n\t%s", k, err)
+			continue
+		}
+		if fn(&entry) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+	return entries
+}
+
+// Claim marks entries matching fn as pending and returns them,
+// so the same payout is never sent by two goroutines at once.
+func (l Ledger) Claim(fn func(e *LedgerEntry) bool) []LedgerEntry {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	claimed := []LedgerEntry{}
+	for _, entry := range l.List(fn) {
+		entry.Status = PayoutPending
+		if err := l.put(&entry); err != nil {
+			Error.Printf("Can't claim ledger entry:\n\tID: %d\n\t%s", entry.ID, err)
+			continue
+		}
+		claimed = append(claimed, entry)
+	}
+
+	return claimed
+}
+
+// Len returns number of entries.
+func (l Ledger) Len() int {
+	return l.data.Len()
+}
+
+// payoutBackoff returns delay before the next attempt of a failed payout.
+// The delay doubles with every attempt up to maxPayoutBackoff.
+func payoutBackoff(attempts int) time.Duration {
+	delay := minPayoutBackoff
+	for i := 1; i < attempts && delay < maxPayoutBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxPayoutBackoff {
+		delay = maxPayoutBackoff
+	}
+
+	return delay
+}
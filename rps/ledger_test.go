@@ -0,0 +1,131 @@
+package rps
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ledgerEntry returns the only entry of the ledger.
+func ledgerEntry(t *testing.T, ledger *Ledger) LedgerEntry {
+	t.Helper()
+	entries := ledger.List(func(e *LedgerEntry) bool { return true })
+	if len(entries) != 1 {
+		t.Fatalf("ledger has %d entries", len(entries))
+	}
+
+	return entries[0]
+}
+
+func TestPayoutBackoff(t *testing.T) {
+	for _, c := range []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{5, 16 * time.Minute},
+		{100, maxPayoutBackoff},
+	} {
+		if delay := payoutBackoff(c.attempts); delay != c.delay {
+			t.Errorf("%d attempts: delay is %s, not %s", c.attempts, delay, c.delay)
+		}
+	}
+}
+
+func TestPayoutRetry(t *testing.T) {
+	b, _, _, bank := newTestBot(t, 1)
+	bank.Deposit(1)
+	address := "bchtest:qwinner"
+	user := b.users.Get(1)
+	user.SetWalletAddress(address)
+	b.game = &GameRecord{GameID: 1}
+
+	bank.SetPayToError(errors.New("network down"))
+	b.payToUser(user, 0.01)
+	entry := ledgerEntry(t, b.ledger)
+	if entry.Status != PayoutFailed || entry.Attempts != 1 || entry.Error != "network down" {
+		t.Fatalf("failed payout is recorded as %s after %d attempts: %q", entry.Status, entry.Attempts, entry.Error)
+	}
+	if len(b.game.Payouts) != 1 || b.game.Payouts[0].Error != "network down" {
+		t.Errorf("failed payout is recorded in the game as %v", b.game.Payouts)
+	}
+	failedAt := entry.NextAttempt.Add(-minPayoutBackoff)
+
+	// Payout isn't retried until its backoff is over
+	b.retryDuePayouts(failedAt)
+	if entry = ledgerEntry(t, b.ledger); entry.Status != PayoutFailed || entry.Attempts != 1 {
+		t.Fatalf("payout is retried before its backoff is over: %s after %d attempts", entry.Status, entry.Attempts)
+	}
+
+	// Backoff doubles while the payout keeps failing
+	b.retryDuePayouts(entry.NextAttempt)
+	entry = ledgerEntry(t, b.ledger)
+	if entry.Status != PayoutFailed || entry.Attempts != 2 {
+		t.Fatalf("retried payout is %s after %d attempts", entry.Status, entry.Attempts)
+	}
+	if backoff := entry.NextAttempt.Sub(entry.Updated); backoff < 2*minPayoutBackoff-time.Second ||
+		backoff > 2*minPayoutBackoff {
+		t.Errorf("backoff of the second attempt is %s", backoff)
+	}
+	if payouts := bank.Payouts(address); len(payouts) != 0 {
+		t.Fatalf("failed payouts are sent as %v", payouts)
+	}
+
+	bank.SetPayToError(nil)
+	b.retryDuePayouts(entry.NextAttempt)
+	entry = ledgerEntry(t, b.ledger)
+	if entry.Status != PayoutSent || entry.Attempts != 3 || entry.TxID == "" || entry.Error != "" {
+		t.Fatalf("payout is %s after %d attempts, transaction %q, error %q",
+			entry.Status, entry.Attempts, entry.TxID, entry.Error)
+	}
+
+	// Sent payout isn't sent again
+	b.retryDuePayouts(entry.NextAttempt.Add(maxPayoutBackoff))
+	if payouts := bank.Payouts(address); len(payouts) != 1 || payouts[0] != 0.01 {
+		t.Errorf("payouts are sent as %v", payouts)
+	}
+	if balance, _ := bank.GetBalance(); balance != 0.99 {
+		t.Errorf("bank keeps %f", balance)
+	}
+}
+
+func TestWithdraw(t *testing.T) {
+	b, recorder, _, bank := newTestBot(t, 1)
+	bank.Deposit(1)
+	address := "bchtest:qwithdraw"
+	user := b.users.Get(1)
+	user.SetWalletAddress(address)
+
+	// Balance below the minimum isn't withdrawn
+	user.SetBalance(0.001)
+	b.Withdraw(1)
+	if msgs := recorder.Messages(1); len(msgs) != 1 || !strings.Contains(msgs[0].Text, "Minimum amount to withdraw") {
+		t.Errorf("withdrawal below the minimum is answered by %v", msgs)
+	}
+	if b.ledger.Len() != 0 || len(bank.AllPayouts()) != 0 || user.GetBalance() != 0.001 {
+		t.Errorf("balance below the minimum is withdrawn, %d ledger entries, balance %f",
+			b.ledger.Len(), user.GetBalance())
+	}
+
+	// Failed withdrawal is retried as any other payout
+	user.SetBalance(0.005)
+	bank.SetPayToError(errors.New("network down"))
+	b.Withdraw(1)
+	waitMessage(t, recorder, 1, "couldn't be sent right now", time.Second)
+	entry := ledgerEntry(t, b.ledger)
+	if entry.GameID != 0 || entry.Status != PayoutFailed || entry.Amount != 0.005 || user.GetBalance() != 0 {
+		t.Fatalf("withdrawal of game %d is %s for %f, balance left %f",
+			entry.GameID, entry.Status, entry.Amount, user.GetBalance())
+	}
+
+	bank.SetPayToError(nil)
+	b.retryDuePayouts(entry.NextAttempt)
+	if entry = ledgerEntry(t, b.ledger); entry.Status != PayoutSent {
+		t.Errorf("retried withdrawal is %s", entry.Status)
+	}
+	if payouts := bank.Payouts(address); len(payouts) != 1 || payouts[0] != 0.005 {
+		t.Errorf("withdrawal is sent as %v", payouts)
+	}
+}
@@ -0,0 +1,31 @@
+package rps
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	LogsInit(ioutil.Discard, ioutil.Discard, ioutil.Discard, os.Stderr)
+	os.Exit(m.Run())
+}
+
+// openTestStorage opens LevelDB storage in a temporary directory removed with the test.
+func openTestStorage(t *testing.T) Storage {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "rps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := OpenStorage("leveldb", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		storage.Close()
+		os.RemoveAll(dir)
+	})
+
+	return storage
+}
@@ -0,0 +1,227 @@
+package rps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	errNoMatch     = errors.New("player has no match in play")
+	errMoveLocked  = errors.New("move is locked already")
+	errMatchExists = errors.New("player has a match in play already")
+)
+
+// MatchMoves structure.
+// Move state of a match in play: moves of the played throws of both players
+// and moves locked for the current throw.
+type MatchMoves struct {
+	PlayerA  int64        `json:"playerA"`
+	PlayerB  int64        `json:"playerB"`
+	PlayedA  []MoveCommit `json:"playedA"`
+	PlayedB  []MoveCommit `json:"playedB"`
+	PendingA *MoveCommit  `json:"pendingA"`
+	PendingB *MoveCommit  `json:"pendingB"`
+}
+
+// NewMatchMoves creates an object of MatchMoves structure.
+func NewMatchMoves(playerA, playerB int64) MatchMoves {
+	return MatchMoves{playerA, playerB, []MoveCommit{}, []MoveCommit{}, nil, nil}
+}
+
+// side returns played and locked moves of the player.
+func (m *MatchMoves) side(uid int64) (*[]MoveCommit, **MoveCommit) {
+	if uid == m.PlayerA {
+		return &m.PlayedA, &m.PendingA
+	}
+
+	return &m.PlayedB, &m.PendingB
+}
+
+// Sequence returns codes of the played moves of the player.
+func (m *MatchMoves) Sequence(uid int64) string {
+	played, _ := m.side(uid)
+	moves := make([]byte, 0, len(*played))
+	for _, c := range *played {
+		moves = append(moves, c.Move)
+	}
+
+	return string(moves)
+}
+
+// GameState structure.
+// Vault of move states of the matches in play keyed by their players.
+// Moves are kept apart from the users, so they don't race with other changes of the users.
+type GameState struct {
+	data    KVStore
+	lock    *sync.Mutex
+	matches map[int64]*MatchMoves
+}
+
+// NewGameState creates an object of GameState structure.
+func NewGameState(name string, storage Storage) GameState {
+	lock := sync.Mutex{}
+	data := storage.KV(name)
+
+	return GameState{data, &lock, map[int64]*MatchMoves{}}
+}
+
+// matchKey returns key of the move state of the match.
+func matchKey(m *MatchMoves) string {
+	return fmt.Sprintf("%d:%d", m.PlayerA, m.PlayerB)
+}
+
+// put saves move state of the match, the lock must be held.
+func (s GameState) put(m *MatchMoves) error {
+	value, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return s.data.Put(matchKey(m), string(value))
+}
+
+// StartMatch creates move state of the match of the players.
+func (s GameState) StartMatch(playerA, playerB int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.matches[playerA]; ok {
+		return errMatchExists
+	}
+	if _, ok := s.matches[playerB]; ok {
+		return errMatchExists
+	}
+	m := NewMatchMoves(playerA, playerB)
+	s.matches[playerA], s.matches[playerB] = &m, &m
+
+	return s.put(&m)
+}
+
+// EndMatch removes move state of the match of the player.
+// Moves made after the last throw of the match are dropped with it.
+func (s GameState) EndMatch(uid int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	m, ok := s.matches[uid]
+	if !ok {
+		return errNoMatch
+	}
+	delete(s.matches, m.PlayerA)
+	delete(s.matches, m.PlayerB)
+
+	return s.data.Delete(matchKey(m))
+}
+
+// Lock locks the move of the player for the current throw of its match.
+// The locked move is replaced only if it's allowed to change it.
+// Returns the move locked for the throw.
+func (s GameState) Lock(uid int64, commit MoveCommit, change bool) (MoveCommit, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	m, ok := s.matches[uid]
+	if !ok {
+		return MoveCommit{}, errNoMatch
+	}
+	_, pending := m.side(uid)
+	if *pending != nil && !change {
+		return **pending, errMoveLocked
+	}
+	*pending = &commit
+
+	return commit, s.put(m)
+}
+
+// Ready checks if both players of the match of the player locked their moves.
+func (s GameState) Ready(uid int64) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	m, ok := s.matches[uid]
+
+	return ok && m.PendingA != nil && m.PendingB != nil
+}
+
+// Take returns the move locked by the player and unlocks it.
+// The state is saved when the move is settled.
+func (s GameState) Take(uid int64) (MoveCommit, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	m, ok := s.matches[uid]
+	if !ok {
+		return MoveCommit{}, false
+	}
+	_, pending := m.side(uid)
+	if *pending == nil {
+		return MoveCommit{}, false
+	}
+	commit := **pending
+	*pending = nil
+
+	return commit, true
+}
+
+// Settle adds the move to the played moves of the player.
+func (s GameState) Settle(uid int64, commit MoveCommit) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	m, ok := s.matches[uid]
+	if !ok {
+		return errNoMatch
+	}
+	played, _ := m.side(uid)
+	*played = append(*played, commit)
+
+	return s.put(m)
+}
+
+// Opponent returns opponent of the player in its match.
+func (s GameState) Opponent(uid int64) (int64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	m, ok := s.matches[uid]
+	if !ok {
+		return 0, false
+	}
+	if uid == m.PlayerA {
+		return m.PlayerB, true
+	}
+
+	return m.PlayerA, true
+}
+
+// Sequence returns codes of the moves the player played in its match.
+func (s GameState) Sequence(uid int64) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	m, ok := s.matches[uid]
+	if !ok {
+		return ""
+	}
+
+	return m.Sequence(uid)
+}
+
+// Reset removes move states of all the matches, including ones left by an interrupted game.
+func (s GameState) Reset() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for k := range s.matches {
+		delete(s.matches, k)
+	}
+	for k := range s.data.Iterate() {
+		if err := s.data.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
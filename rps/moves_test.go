@@ -0,0 +1,52 @@
+package rps
+
+import (
+	"strings"
+	"testing"
+)
+
+// commitmentOf returns commitment given by the message.
+func commitmentOf(msg SentMessage) string {
+	parts := strings.Split(msg.Text, "`")
+	if len(parts) < 3 {
+		return ""
+	}
+
+	return parts[1]
+}
+
+func TestMakeAMoveSendsCommitmentToOpponent(t *testing.T) {
+	for _, change := range []bool{false, true} {
+		b := newSeedTestBot(t, 1, 2)
+		b.opts.changeMove = change
+		recorder := NewRecorder()
+		b.transport = recorder
+		state := NewGameState("state", b.storage)
+		b.state = &state
+		if err := b.stats.Put("game", "true"); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.state.StartMatch(1, 2); err != nil {
+			t.Fatal(err)
+		}
+
+		b.MakeAMove('R', 1)
+		mover, opponent := recorder.Messages(1), recorder.Messages(2)
+		if len(mover) != 1 || len(opponent) != 1 {
+			t.Fatalf("change %t: %d messages to the mover, %d to the opponent", change, len(mover), len(opponent))
+		}
+		commitment := commitmentOf(mover[0])
+		if commitment == "" || commitmentOf(opponent[0]) != commitment {
+			t.Errorf("change %t: opponent got %q, mover got %q", change, opponent[0].Text, mover[0].Text)
+		}
+
+		// Commitment sent is the one of the locked move
+		commit, ok := b.state.Take(1)
+		if !ok || commit.Commitment(1) != commitment {
+			t.Errorf("change %t: commitment of the locked move isn't sent", change)
+		}
+		if _, ok := b.state.Opponent(3); ok {
+			t.Errorf("change %t: player without a match has an opponent", change)
+		}
+	}
+}
@@ -1,20 +1,29 @@
 package rps
 
+import "fmt"
+
 // Options structure.
 type Options struct {
-	capacity          uint
-	timeout           uint
-	opTimeout         uint
-	modifyTime        uint
-	roundTime         uint
-	payTime           uint
-	schedule          string
-	ticketPrice       float64
-	testnet           bool
-	donationAddress   string
-	dbPath            string
-	cashboxWalletPath string
-	bankWalletPath    string
+	capacity        uint
+	timeout         uint
+	opTimeout       uint
+	modifyTime      uint
+	roundTime       uint
+	payTime         uint
+	schedule        string
+	ticketPrice     float64
+	donationAddress string
+	minWithdrawal   float64
+	ticketLifetime  uint
+	operatorID      int64
+	prizeStrategy   PrizeStrategy
+	feePercent      float64
+	feePerTicket    float64
+	operatorAddress string
+	bestOf          uint
+	drawTimeout     uint
+	rules           RuleSet
+	changeMove      bool
 }
 
 // NewOptions creates an object of NewOptions structure.
@@ -27,14 +36,38 @@ func NewOptions(
 	payTime uint,
 	schedule string,
 	ticketPrice float64,
-	testnet bool,
 	donationAddress string,
-	dbPath string,
-	cashboxWalletPath string,
-	bankWalletPath string,
+	minWithdrawal float64,
+	ticketLifetime uint,
+	operatorID int64,
+	prizeStrategy PrizeStrategy,
+	feePercent float64,
+	feePerTicket float64,
+	operatorAddress string,
+	bestOf uint,
+	drawTimeout uint,
+	rules RuleSet,
+	changeMove bool,
 ) Options {
 	return Options{
 		capacity, timeout, opTimeout, modifyTime, roundTime, payTime, schedule,
-		ticketPrice, testnet, donationAddress, dbPath, cashboxWalletPath, bankWalletPath,
+		ticketPrice, donationAddress, minWithdrawal, ticketLifetime, operatorID,
+		prizeStrategy, feePercent, feePerTicket, operatorAddress, bestOf, drawTimeout,
+		rules, changeMove,
+	}
+}
+
+// CheckHouseFee validates options of the house fee.
+func CheckHouseFee(feePercent, feePerTicket, ticketPrice float64, operatorAddress string) error {
+	if feePercent < 0 || feePercent > 100 {
+		return fmt.Errorf("fee percentage must be in range of 0 to 100: %f", feePercent)
 	}
+	if feePerTicket < 0 || feePerTicket > ticketPrice {
+		return fmt.Errorf("fee per ticket must be in range of 0 to the ticket price: %f", feePerTicket)
+	}
+	if (feePercent > 0 || feePerTicket > 0) && operatorAddress == "" {
+		return fmt.Errorf("operator address is required to take the house fee")
+	}
+
+	return nil
 }
@@ -0,0 +1,305 @@
+package rps
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Place structure.
+// Describes how far a player went in the game.
+type Place struct {
+	// Players is number of players at the start of the game.
+	Players int
+	// Round is the round the player lost in, Rounds()+1 for the final winner.
+	Round int
+	// Wins is number of matches won by the player, byes aren't counted.
+	Wins int
+}
+
+// Rounds returns number of rounds of the game.
+func (p Place) Rounds() int {
+	rounds := 0
+	for c := 1; c < p.Players; c = c << 1 {
+		rounds++
+	}
+
+	return rounds
+}
+
+// Reached returns number of players who took part in the round
+// including players passing it by a bye.
+func (p Place) Reached(round int) int {
+	if round <= 1 {
+		return p.Players
+	}
+
+	return 1 << uint(Max(p.Rounds()-round+1, 0))
+}
+
+// Winner checks if the place is the first one.
+func (p Place) Winner() bool {
+	return p.Round > p.Rounds()
+}
+
+// Rank returns the best place among players lost in the same round, 1 for the final winner.
+func (p Place) Rank() int {
+	if p.Winner() {
+		return 1
+	}
+
+	return p.Reached(p.Round+1) + 1
+}
+
+// Shared returns number of players sharing the rank of the place.
+func (p Place) Shared() int {
+	if p.Winner() {
+		return 1
+	}
+
+	return p.Reached(p.Round) - p.Reached(p.Round+1)
+}
+
+// PrizeStrategy is the rule of the prize distribution.
+// Total of the prizes of all the places of a game must not exceed the pot.
+type PrizeStrategy interface {
+	// Prize returns amount won by the player finished at the place.
+	Prize(place Place, pot float64) float64
+	// Description explains the distribution to players.
+	Description() string
+	// Name returns the strategy the way ParsePrizeStrategy takes it.
+	Name() string
+}
+
+// ProgressiveRefund structure.
+// Each won match is worth a ticket, so only players lost their very first match lose.
+// The final winner takes the rest of the pot.
+type ProgressiveRefund struct {
+	ticketPrice float64
+}
+
+// NewProgressiveRefund creates an object of ProgressiveRefund structure.
+func NewProgressiveRefund(ticketPrice float64) ProgressiveRefund {
+	return ProgressiveRefund{ticketPrice}
+}
+
+// Prize implements PrizeStrategy.
+// Every match is won by someone, so players other than the final winner
+// won Players-1-Wins matches at most, which is less than the pot.
+func (s ProgressiveRefund) Prize(place Place, pot float64) float64 {
+	if place.Winner() {
+		return pot - float64(place.Players-1-place.Wins)*s.ticketPrice
+	}
+
+	return float64(place.Wins) * s.ticketPrice
+}
+
+// Description implements PrizeStrategy.
+func (s ProgressiveRefund) Description() string {
+	return "The game is lost for you *only* if you're lost your very first match " +
+		"any other outcome is at least non-loss. For example, if you lose the " +
+		"second match you get your money back, if you lose the " +
+		"third match you get x2 of ticket price, if you lose the " +
+		"fourth match you get x3 of ticket price and so on. The final winner " +
+		"get a special prize - all the non raffled money."
+}
+
+// Name implements PrizeStrategy.
+func (s ProgressiveRefund) Name() string {
+	return "progressive"
+}
+
+// WinnerTakesAll structure.
+type WinnerTakesAll struct{}
+
+// NewWinnerTakesAll creates an object of WinnerTakesAll structure.
+func NewWinnerTakesAll() WinnerTakesAll {
+	return WinnerTakesAll{}
+}
+
+// Prize implements PrizeStrategy.
+func (s WinnerTakesAll) Prize(place Place, pot float64) float64 {
+	if place.Winner() {
+		return pot
+	}
+
+	return 0
+}
+
+// Description implements PrizeStrategy.
+func (s WinnerTakesAll) Description() string {
+	return "The final winner takes the whole pot."
+}
+
+// Name implements PrizeStrategy.
+func (s WinnerTakesAll) Name() string {
+	return "winner"
+}
+
+// TopSplit structure.
+// The pot is split equally between players who reached the round of top players.
+type TopSplit struct {
+	top int
+}
+
+// NewTopSplit creates an object of TopSplit structure.
+func NewTopSplit(top int) TopSplit {
+	return TopSplit{top}
+}
+
+// Prize implements PrizeStrategy.
+// Exactly Reached(round) players share the pot.
+func (s TopSplit) Prize(place Place, pot float64) float64 {
+	round := 1
+	for place.Reached(round) > s.top {
+		round++
+	}
+	if place.Round < round {
+		return 0
+	}
+
+	return pot / float64(place.Reached(round))
+}
+
+// Description implements PrizeStrategy.
+func (s TopSplit) Description() string {
+	return fmt.Sprintf("The pot is split equally between the top %d players. "+
+		"If players of the same round don't fit into the top, "+
+		"the pot is split between players of the next round.", s.top)
+}
+
+// Name implements PrizeStrategy.
+func (s TopSplit) Name() string {
+	return fmt.Sprintf("top:%d", s.top)
+}
+
+// FixedPercentages structure.
+// Each place gets a fixed share of the pot, players lost in the same round
+// split the shares of their places equally.
+// The rest of the pot isn't paid.
+type FixedPercentages struct {
+	shares []float64
+}
+
+// NewFixedPercentages creates an object of FixedPercentages structure.
+// Shares are percentages of the pot starting from the first place, the sum must not exceed 100.
+func NewFixedPercentages(shares []float64) (FixedPercentages, error) {
+	total := 0.0
+	for _, share := range shares {
+		if share < 0 {
+			return FixedPercentages{}, fmt.Errorf("share can't be negative: %f", share)
+		}
+		total += share
+	}
+	if total > 100 {
+		return FixedPercentages{}, fmt.Errorf("sum of the shares exceeds 100%%: %f", total)
+	}
+
+	return FixedPercentages{shares}, nil
+}
+
+// Prize implements PrizeStrategy.
+func (s FixedPercentages) Prize(place Place, pot float64) float64 {
+	first, shared := place.Rank()-1, place.Shared()
+	total := 0.0
+	for i := first; i < first+shared && i < len(s.shares); i++ {
+		total += s.shares[i]
+	}
+
+	return pot * total / 100 / float64(shared)
+}
+
+// Description implements PrizeStrategy.
+func (s FixedPercentages) Description() string {
+	places := []string{}
+	for i, share := range s.shares {
+		places = append(places, fmt.Sprintf("%d. %g%%", i+1, share))
+	}
+
+	return fmt.Sprintf("Places get fixed shares of the pot: %s. "+
+		"Players lost in the same round split the shares of their places equally.",
+		strings.Join(places, ", "))
+}
+
+// Name implements PrizeStrategy.
+func (s FixedPercentages) Name() string {
+	shares := []string{}
+	for _, share := range s.shares {
+		shares = append(shares, strconv.FormatFloat(share, 'g', -1, 64))
+	}
+
+	return "fixed:" + strings.Join(shares, ",")
+}
+
+// ParsePrizeStrategy creates prize strategy by its name:
+// progressive, winner, top:N or fixed:P1,P2,...
+func ParsePrizeStrategy(name string, ticketPrice float64) (PrizeStrategy, error) {
+	kind, arg := name, ""
+	if i := strings.Index(name, ":"); i != -1 {
+		kind, arg = name[:i], name[i+1:]
+	}
+
+	switch kind {
+	case "progressive":
+		return NewProgressiveRefund(ticketPrice), nil
+	case "winner":
+		return NewWinnerTakesAll(), nil
+	case "top":
+		top, err := strconv.Atoi(arg)
+		if err != nil || top < 1 {
+			return nil, fmt.Errorf("invalid number of top players: %s", arg)
+		}
+		return NewTopSplit(top), nil
+	case "fixed":
+		shares := []float64{}
+		for _, s := range strings.Split(arg, ",") {
+			share, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid share: %s", s)
+			}
+			shares = append(shares, share)
+		}
+		return NewFixedPercentages(shares)
+	}
+
+	return nil, fmt.Errorf("unknown prize strategy: %s", name)
+}
+
+// clampPrize cuts the prize down to the unpaid rest of the pot and to whole satoshis,
+// so payouts never exceed the pot whatever the strategy returns.
+func clampPrize(prize, pot, paid float64) float64 {
+	// NaN has to be checked first, it isn't less than anything
+	if math.IsNaN(prize) {
+		return 0
+	}
+	prize = MinFloat64(prize, pot-paid)
+	if prize <= 0 {
+		return 0
+	}
+
+	// Tolerance keeps amounts like 0.003 from losing a satoshi on float error
+	return math.Floor(prize*1e8+1e-4) / 1e8
+}
+
+// houseFee returns the house fee taken from the tickets of a game.
+// The fee never exceeds price of the tickets.
+func houseFee(tickets int, opts *Options) float64 {
+	amount := float64(tickets) * opts.ticketPrice
+	fee := amount*opts.feePercent/100 + float64(tickets)*opts.feePerTicket
+
+	return clampPrize(fee, amount, 0)
+}
+
+// feeDescription explains the house fee to players or returns empty string if there is no fee.
+func feeDescription(opts *Options) string {
+	parts := []string{}
+	if opts.feePercent > 0 {
+		parts = append(parts, fmt.Sprintf("%g%% of the tickets of each game", opts.feePercent))
+	}
+	if opts.feePerTicket > 0 {
+		parts = append(parts, fmt.Sprintf("%g BCH per ticket", opts.feePerTicket))
+	}
+
+	return strings.Join(parts, " plus ")
+}
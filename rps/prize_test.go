@@ -0,0 +1,188 @@
+package rps
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// playPrizes plays the game of the players by scripted moves with the prize strategy.
+func playPrizes(t *testing.T, game *GameRecord, strategy PrizeStrategy) {
+	t.Helper()
+	opts := &Options{ticketPrice: 0.001, prizeStrategy: strategy, bestOf: 1, roundTime: 10,
+		drawTimeout: 20, rules: ClassicRules()}
+	playRounds(t, game, opts)
+}
+
+// testGame returns record of the game of n players with the fee and the jackpot.
+func testGame(n int, opts *Options, jackpot float64) GameRecord {
+	tickets := float64(n) * opts.ticketPrice
+	fee := houseFee(n, opts)
+	game := GameRecord{GameID: uint64(n), ServerSeed: "server", ClientSeed: fmt.Sprint("client", n),
+		Pot: tickets - fee + jackpot, TicketsAmount: tickets, Fee: fee, Jackpot: jackpot}
+	for i := 1; i <= n; i++ {
+		game.Participants = append(game.Participants, Participant{UserID: int64(i)})
+	}
+
+	return game
+}
+
+func TestPrizeStrategiesDontExceedPot(t *testing.T) {
+	strategies := []string{"progressive", "winner", "top:1", "top:3", "top:4", "top:100",
+		"fixed:50,30,20", "fixed:70,20,5,5", "fixed:100", "fixed:10,10,10,10,10,10,10,10,10,10"}
+	fees := []struct {
+		percent   float64
+		perTicket float64
+	}{
+		{0, 0},
+		{10, 0},
+		{5, 0.0001},
+		// Fee takes more than the progressive refunds need
+		{60, 0},
+	}
+
+	for _, name := range strategies {
+		for _, fee := range fees {
+			for _, jackpot := range []float64{0, 0.0123} {
+				for n := 2; n <= 33; n++ {
+					opts := &Options{ticketPrice: 0.001, feePercent: fee.percent, feePerTicket: fee.perTicket}
+					strategy, err := ParsePrizeStrategy(name, opts.ticketPrice)
+					if err != nil {
+						t.Fatal(err)
+					}
+					game := testGame(n, opts, jackpot)
+					playPrizes(t, &game, strategy)
+
+					title := fmt.Sprintf("%s, %d players, fee %g%%+%g, jackpot %g",
+						name, n, fee.percent, fee.perTicket, jackpot)
+					if game.Winner == 0 {
+						t.Errorf("%s: game has no winner", title)
+					}
+					if paid := game.Paid(); paid > game.Pot+1e-12 {
+						t.Errorf("%s: %f paid of the pot %f", title, paid, game.Pot)
+					}
+
+					// The raw prizes of all the places fit into the pot as well
+					total := 0.0
+					for _, p := range game.Participants {
+						round := len(game.Rounds) + 1
+						if p.UserID != game.Winner {
+							round = lostRound(&game, p.UserID)
+						}
+						total += strategy.Prize(game.Place(p.UserID, round), game.Pot)
+					}
+					if total > game.Pot+1e-9 {
+						t.Errorf("%s: prizes %f exceed the pot %f", title, total, game.Pot)
+					}
+				}
+			}
+		}
+	}
+}
+
+// lostRound returns the round the player lost in.
+func lostRound(game *GameRecord, uid int64) int {
+	for _, r := range game.Rounds {
+		for _, m := range r.Matches {
+			if m.Loser == uid {
+				return r.Number
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestPrizeStrategyPlaces(t *testing.T) {
+	const price = 0.001
+	tests := []struct {
+		strategy string
+		place    Place
+		pot      float64
+		prize    float64
+	}{
+		// 5 players: 1 match in the first round, 3 byes, then 2 rounds
+		{"progressive", Place{5, 1, 0}, 0.005, 0},
+		{"progressive", Place{5, 2, 0}, 0.005, 0},
+		{"progressive", Place{5, 2, 1}, 0.005, 0.001},
+		{"progressive", Place{5, 3, 1}, 0.005, 0.001},
+		{"progressive", Place{5, 4, 2}, 0.005, 0.003},
+		{"progressive", Place{5, 4, 3}, 0.005, 0.004},
+		{"winner", Place{5, 3, 2}, 0.005, 0},
+		{"winner", Place{5, 4, 2}, 0.005, 0.005},
+		{"top:4", Place{5, 1, 0}, 0.004, 0},
+		{"top:4", Place{5, 2, 0}, 0.004, 0.001},
+		{"top:4", Place{5, 4, 2}, 0.004, 0.001},
+		// Players of the second round don't fit into the top of 3, so it's made of the 2 finalists
+		{"top:3", Place{5, 2, 1}, 0.004, 0},
+		{"top:3", Place{5, 3, 1}, 0.004, 0.002},
+		{"top:1", Place{6, 3, 1}, 0.006, 0},
+		{"top:1", Place{6, 4, 2}, 0.006, 0.006},
+		{"top:10", Place{6, 1, 0}, 0.006, 0.001},
+		// 6 players: places 5-6 lost in the first round, 3-4 in the second, 2 in the final
+		{"fixed:50,30,20", Place{6, 4, 3}, 0.01, 0.005},
+		{"fixed:50,30,20", Place{6, 3, 2}, 0.01, 0.003},
+		{"fixed:50,30,20", Place{6, 2, 1}, 0.01, 0.001},
+		{"fixed:50,30,20", Place{6, 1, 0}, 0.01, 0},
+		{"fixed:40,30,20,5,5", Place{7, 1, 0}, 0.01, 0.0005 / 3},
+	}
+
+	for _, test := range tests {
+		strategy, err := ParsePrizeStrategy(test.strategy, price)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prize := strategy.Prize(test.place, test.pot); math.Abs(prize-test.prize) > 1e-12 {
+			t.Errorf("%s, place %+v: prize %g, %g expected", test.strategy, test.place, prize, test.prize)
+		}
+	}
+}
+
+func TestParsePrizeStrategyErrors(t *testing.T) {
+	for _, name := range []string{"", "unknown", "top:0", "top:x", "fixed:", "fixed:60,50", "fixed:-1"} {
+		if _, err := ParsePrizeStrategy(name, 0.001); err == nil {
+			t.Errorf("%q is parsed", name)
+		}
+	}
+}
+
+func TestClampPrize(t *testing.T) {
+	tests := []struct {
+		prize float64
+		pot   float64
+		paid  float64
+		want  float64
+	}{
+		{0.003, 1, 0, 0.003},
+		// Float error of the sum doesn't cost a satoshi
+		{0.1 + 0.2, 1, 0, 0.3},
+		{0.29, 1, 0, 0.29},
+		// Fractions of a satoshi are cut
+		{0.123456789, 1, 0, 0.12345678},
+		{0.000000009, 1, 0, 0},
+		// The unpaid rest of the pot is the limit
+		{1, 0.5, 0.2, 0.3},
+		{1, 0.5, 0.5, 0},
+		{1, 0.5, 0.7, 0},
+		{-0.1, 1, 0, 0},
+		{math.NaN(), 1, 0, 0},
+	}
+
+	for _, test := range tests {
+		if got := clampPrize(test.prize, test.pot, test.paid); math.Abs(got-test.want) > 1e-12 {
+			t.Errorf("clampPrize(%g, %g, %g) = %.10f, %g expected", test.prize, test.pot, test.paid, got, test.want)
+		}
+	}
+}
+
+func TestPrizeStrategyName(t *testing.T) {
+	for _, name := range []string{"progressive", "winner", "top:3", "fixed:50,30,20", "fixed:62.5,37.5"} {
+		strategy, err := ParsePrizeStrategy(name, 0.001)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strategy.Name() != name {
+			t.Errorf("%q is named %q", name, strategy.Name())
+		}
+	}
+}
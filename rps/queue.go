@@ -0,0 +1,132 @@
+package rps
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueueEntry structure.
+// A ticket waiting for its game.
+type QueueEntry struct {
+	UserID    int64     `json:"userID"`
+	TicketID  uint64    `json:"ticketID"`
+	Purchased time.Time `json:"purchased"`
+	Expires   time.Time `json:"expires"`
+}
+
+// TicketQueue structure.
+// Durable FIFO queue of tickets ordered by purchase time.
+// Players are seated in order of their oldest ticket,
+// so tickets which didn't fit into a game keep their place.
+type TicketQueue struct {
+	data  KVStore
+	stats KVStore
+	lock  *sync.Mutex
+}
+
+// NewTicketQueue creates an object of TicketQueue structure.
+// Counter of the tickets is kept in stats.
+func NewTicketQueue(name string, storage Storage, stats KVStore) TicketQueue {
+	lock := sync.Mutex{}
+	data := storage.KV(name)
+
+	return TicketQueue{data, stats, &lock}
+}
+
+// queueKey returns key of the ticket ordered by purchase time, then by ticket ID.
+func queueKey(ticket Ticket) string {
+	return fmt.Sprintf("%020d:%020d", ticket.Purchased.UnixNano(), ticket.ID)
+}
+
+// AssignIDs gives IDs to the tickets which have none.
+func (q TicketQueue) AssignIDs(tickets []Ticket) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i := range tickets {
+		if tickets[i].ID != 0 {
+			continue
+		}
+		id, err := nextCounter(q.stats, "lastTicketID")
+		if err != nil {
+			return err
+		}
+		tickets[i].ID = id
+	}
+
+	return nil
+}
+
+// TxPush puts tickets of the user into the queue as a part of the transaction.
+// Tickets must have IDs assigned.
+func (q TicketQueue) TxPush(tx *Tx, uid int64, tickets ...Ticket) {
+	for _, ticket := range tickets {
+		// Marshaling of plain fields can't fail
+		value, _ := json.Marshal(QueueEntry{uid, ticket.ID, ticket.Purchased, ticket.Expires})
+		q.data.TxPut(tx, queueKey(ticket), string(value))
+	}
+}
+
+// TxRemove removes tickets from the queue as a part of the transaction.
+func (q TicketQueue) TxRemove(tx *Tx, tickets ...Ticket) {
+	for _, ticket := range tickets {
+		q.data.TxDelete(tx, queueKey(ticket))
+	}
+}
+
+// List returns all the queued tickets, the oldest first.
+func (q TicketQueue) List() []QueueEntry {
+	data := q.data.Iterate()
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	entries := []QueueEntry{}
+	for _, k := range keys {
+		var entry QueueEntry
+		if err := json.Unmarshal([]byte(data[k]), &entry); err != nil {
+			Error.Printf("Can't deserialize queue entry:\n\tKey: %s\n\t%s", k, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// Players returns users in order they are going to be seated.
+// Each user takes a single place by the oldest ticket.
+func (q TicketQueue) Players() []int64 {
+	players := []int64{}
+	seen := map[int64]bool{}
+	for _, entry := range q.List() {
+		if !seen[entry.UserID] {
+			seen[entry.UserID] = true
+			players = append(players, entry.UserID)
+		}
+	}
+
+	return players
+}
+
+// Position returns place of the user in the queue starting from 1
+// or 0 if the user isn't in the queue.
+func (q TicketQueue) Position(uid int64) int {
+	for i, id := range q.Players() {
+		if id == uid {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// Len returns number of queued tickets.
+func (q TicketQueue) Len() int {
+	return q.data.Len()
+}
@@ -0,0 +1,70 @@
+package rps
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTicketQueueListWhileChanging(t *testing.T) {
+	storage := openTestStorage(t)
+	queue := NewTicketQueue("queue", storage, storage.KV("stats"))
+
+	start := time.Now()
+	tickets := make([]Ticket, 100)
+	for i := range tickets {
+		tickets[i] = Ticket{Purchased: start.Add(time.Duration(i) * time.Second)}
+	}
+	if err := queue.AssignIDs(tickets); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i, ticket := range tickets {
+			uid := int64(i + 1)
+			err := storage.Update(func(tx *Tx) error {
+				queue.TxPush(tx, uid, ticket)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if i%2 == 1 {
+				continue
+			}
+			err = storage.Update(func(tx *Tx) error {
+				queue.TxRemove(tx, ticket)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			queue.List()
+			queue.Position(int64(i + 1))
+		}
+	}()
+	wg.Wait()
+
+	players := queue.Players()
+	if len(players) != 50 {
+		t.Fatalf("%d players queued, 50 expected", len(players))
+	}
+	for i, uid := range players {
+		if uid != int64(2*i+2) {
+			t.Errorf("player %d is queued at %d, %d expected", uid, i+1, 2*i+2)
+		}
+	}
+	if queue.Len() != 50 {
+		t.Errorf("%d tickets queued, 50 expected", queue.Len())
+	}
+}
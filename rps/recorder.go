@@ -0,0 +1,76 @@
+package rps
+
+import "sync"
+
+// SentMessage structure.
+// A message sent by the bot through Recorder.
+type SentMessage struct {
+	ChatID   int64
+	Text     string
+	Keyboard Keyboard
+}
+
+// Recorder structure.
+// Implements Transport in memory, intended for driving the bot from tests.
+type Recorder struct {
+	updates chan Update
+	sent    []SentMessage
+	lock    *sync.RWMutex
+}
+
+// NewRecorder creates an object of Recorder structure.
+func NewRecorder() *Recorder {
+	lock := sync.RWMutex{}
+
+	return &Recorder{make(chan Update, 100), []SentMessage{}, &lock}
+}
+
+// Send records the message.
+func (r *Recorder) Send(chatID int64, text string, keyboard Keyboard) error {
+	(*r.lock).Lock()
+	defer (*r.lock).Unlock()
+	r.sent = append(r.sent, SentMessage{chatID, text, keyboard})
+
+	return nil
+}
+
+// Updates returns channel of updates pushed by Push.
+func (r *Recorder) Updates() (<-chan Update, error) {
+	return r.updates, nil
+}
+
+// Push delivers an update to the bot as if a user sent it.
+func (r *Recorder) Push(update Update) {
+	r.updates <- update
+}
+
+// Close stops delivering updates, so the bot's update loop ends.
+func (r *Recorder) Close() {
+	close(r.updates)
+}
+
+// Messages returns every message sent to the chat in order of sending.
+func (r *Recorder) Messages(chatID int64) []SentMessage {
+	(*r.lock).RLock()
+	defer (*r.lock).RUnlock()
+
+	lst := []SentMessage{}
+	for _, msg := range r.sent {
+		if msg.ChatID == chatID {
+			lst = append(lst, msg)
+		}
+	}
+
+	return lst
+}
+
+// AllMessages returns every message sent by the bot in order of sending.
+func (r *Recorder) AllMessages() []SentMessage {
+	(*r.lock).RLock()
+	defer (*r.lock).RUnlock()
+
+	lst := make([]SentMessage, len(r.sent))
+	copy(lst, r.sent)
+
+	return lst
+}
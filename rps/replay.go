@@ -0,0 +1,232 @@
+package rps
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// recordedMoves structure.
+// Implements MoveSource of the replay, moves of the players are taken from the recorded throws.
+// Pairings, automatic moves and coin flips are derived from the revealed seeds,
+// games played before seeds were kept are re-run with their recorded pairings and coin flips.
+type recordedMoves struct {
+	game *GameRecord
+}
+
+// seeded checks if the game was played by the seeds.
+func (m recordedMoves) seeded() bool {
+	return m.game.ServerSeed != ""
+}
+
+// Pairs implements MoveSource, pairing of the bracket must match the recorded one.
+func (m recordedMoves) Pairs(round int, players []int64, fair Fair) ([][2]int64, []int64, error) {
+	if round > len(m.game.Rounds) {
+		return nil, nil, fmt.Errorf("round %d isn't recorded", round)
+	}
+	recorded := m.game.Rounds[round-1].Matches
+
+	pairs, byes := [][2]int64{}, []int64{}
+	if m.seeded() {
+		pairs, byes = bracket(players, fair)
+	} else {
+		for _, match := range recorded {
+			if match.PlayerB == -1 {
+				byes = append(byes, match.PlayerA)
+			} else {
+				pairs = append(pairs, [2]int64{match.PlayerA, match.PlayerB})
+			}
+		}
+	}
+	if len(pairs)+len(byes) != len(recorded) {
+		return nil, nil, fmt.Errorf("round %d: %d matches expected, %d recorded",
+			round, len(pairs)+len(byes), len(recorded))
+	}
+
+	matches := append([][2]int64{}, pairs...)
+	for _, id := range byes {
+		matches = append(matches, [2]int64{id, -1})
+	}
+	for i, pair := range matches {
+		if pair[0] != recorded[i].PlayerA || pair[1] != recorded[i].PlayerB {
+			return nil, nil, fmt.Errorf("round %d match %d: pairing differs, moves of the match are unknown",
+				round, i+1)
+		}
+	}
+
+	return pairs, byes, nil
+}
+
+// StartMatch implements MoveSource.
+func (m recordedMoves) StartMatch(playerA, playerB int64) error {
+	return nil
+}
+
+// Throw implements MoveSource.
+func (m recordedMoves) Throw(
+	round, match, number int,
+	playerA, playerB int64,
+	autoA, autoB byte,
+) (ThrowRecord, error) {
+	throws := m.game.Rounds[round-1].Matches[match].ThrowList()
+	if number >= len(throws) {
+		return ThrowRecord{}, fmt.Errorf("throw %d isn't recorded", number+1)
+	}
+
+	t := throws[number]
+	if m.seeded() {
+		if t.AutoA {
+			t.MoveA = string(autoA)
+		}
+		if t.AutoB {
+			t.MoveB = string(autoB)
+		}
+		t.Winner, t.CoinFlip = 0, false
+	} else if !t.CoinFlip {
+		// Coin flips of the games without seeds can't be repeated, so they are kept
+		t.Winner = 0
+	}
+
+	return t, nil
+}
+
+// ThrowOver implements MoveSource.
+func (m recordedMoves) ThrowOver(t *ThrowRecord, playerA, playerB int64, winsA, winsB int) {}
+
+// EndMatch implements MoveSource.
+func (m recordedMoves) EndMatch(playerA, playerB int64) {}
+
+// ReplayGame re-runs the game offline the way Play runs it, moves are taken from the recorded throws.
+// Match format and prizes are the ones the game was started with,
+// games recorded before they were kept are re-run by the options.
+// Returns record of the re-run game, error means the record lacks moves to re-run it.
+func ReplayGame(game *GameRecord, opts *Options) (GameRecord, error) {
+	replayed := *game
+	replayed.Rounds, replayed.Winner, replayed.Payouts = []RoundRecord{}, 0, []PayoutRecord{}
+
+	recorded, err := game.Options(opts)
+	if err != nil {
+		return replayed, err
+	}
+	replay := newEngine(&replayed, &recorded, recordedMoves{game})
+	pay := func(uid int64, result matchResult, prize float64) {
+		if (result == resultLost || result == resultFinal) && prize > 0 {
+			replayed.Payouts = append(replayed.Payouts, PayoutRecord{UserID: uid, Amount: prize})
+		}
+	}
+
+	players := []int64{}
+	for _, p := range game.Participants {
+		players = append(players, p.UserID)
+	}
+	for len(players) > 1 {
+		if players, err = replay.playRound(players, pay); err != nil {
+			return replayed, err
+		}
+	}
+
+	return replayed, nil
+}
+
+// CompareGames checks the re-run game against its record.
+// Returns list of mismatches of throws, winners and payouts, the empty one means the results match.
+func CompareGames(recorded, replayed *GameRecord) []string {
+	problems := []string{}
+	if len(recorded.Rounds) != len(replayed.Rounds) {
+		problems = append(problems, fmt.Sprintf("%d rounds recorded, %d replayed",
+			len(recorded.Rounds), len(replayed.Rounds)))
+	}
+
+	for r := 0; r < len(recorded.Rounds) && r < len(replayed.Rounds); r++ {
+		for i, m := range replayed.Rounds[r].Matches {
+			name := fmt.Sprintf("round %d match %d", r+1, i+1)
+			rec := recorded.Rounds[r].Matches[i]
+			throws := rec.ThrowList()
+			if len(throws) != len(m.Throws) && m.PlayerB != -1 {
+				problems = append(problems, fmt.Sprintf("%s: %d throws recorded, %d replayed",
+					name, len(throws), len(m.Throws)))
+			}
+			for k := 0; k < len(throws) && k < len(m.Throws); k++ {
+				if throws[k].MoveA != m.Throws[k].MoveA || throws[k].MoveB != m.Throws[k].MoveB {
+					problems = append(problems, fmt.Sprintf("%s throw %d: moves %s-%s recorded, %s-%s replayed",
+						name, k+1, throws[k].MoveA, throws[k].MoveB, m.Throws[k].MoveA, m.Throws[k].MoveB))
+				}
+				if throws[k].Winner != m.Throws[k].Winner {
+					problems = append(problems, fmt.Sprintf("%s throw %d: winner %d recorded, %d replayed",
+						name, k+1, throws[k].Winner, m.Throws[k].Winner))
+				}
+			}
+			if rec.Winner != m.Winner {
+				problems = append(problems, fmt.Sprintf("%s: winner %d recorded, %d replayed",
+					name, rec.Winner, m.Winner))
+			}
+		}
+	}
+
+	if recorded.Winner != replayed.Winner {
+		problems = append(problems, fmt.Sprintf("final winner %d recorded, %d replayed",
+			recorded.Winner, replayed.Winner))
+	}
+
+	if len(recorded.Payouts) != len(replayed.Payouts) {
+		problems = append(problems, fmt.Sprintf("%d payouts recorded, %d replayed",
+			len(recorded.Payouts), len(replayed.Payouts)))
+	}
+	for i := 0; i < len(recorded.Payouts) && i < len(replayed.Payouts); i++ {
+		rec, rep := recorded.Payouts[i], replayed.Payouts[i]
+		// Amounts are whole satoshis, so anything below one is float error
+		if rec.UserID != rep.UserID || math.Abs(rec.Amount-rep.Amount) >= 1e-8 {
+			problems = append(problems, fmt.Sprintf("payout %d: %f to %d recorded, %f to %d replayed",
+				i+1, rec.Amount, rec.UserID, rep.Amount, rep.UserID))
+		}
+	}
+
+	return problems
+}
+
+// ReplayGames re-runs the finished games by the options and logs the results,
+// all the finished games are re-run if no IDs are given.
+// Returns number of games which results differ from their records or can't be re-run.
+func ReplayGames(games Games, gameIDs []uint64, opts *Options) int {
+	records := []GameRecord{}
+	if len(gameIDs) == 0 {
+		records = games.List()
+	}
+	for _, id := range gameIDs {
+		record, err := games.Get(id)
+		if err != nil {
+			Error.Printf("Can't get record of the game:\n\tGameID: %d\n\t%s", id, err)
+			return len(gameIDs)
+		}
+		records = append(records, record)
+	}
+
+	failed := 0
+	for i := range records {
+		game := &records[i]
+		if !game.Finished() {
+			if len(gameIDs) > 0 {
+				Error.Printf("Can't replay the game which isn't over:\n\tGameID: %d", game.GameID)
+				failed++
+			}
+			continue
+		}
+
+		replayed, err := ReplayGame(game, opts)
+		if err != nil {
+			Error.Printf("Can't replay the game:\n\tGameID: %d\n\t%s", game.GameID, err)
+			failed++
+			continue
+		}
+		if problems := CompareGames(game, &replayed); len(problems) > 0 {
+			Error.Printf("Replay of the game differs from its record:\n\tGameID: %d\n\t%s",
+				game.GameID, strings.Join(problems, "\n\t"))
+			failed++
+			continue
+		}
+		Info.Printf("Replay of the game matches its record:\n\tGameID: %d\n\tWinner: %d\n\tPayouts: %d",
+			game.GameID, replayed.Winner, len(replayed.Payouts))
+	}
+
+	return failed
+}
@@ -0,0 +1,128 @@
+package rps
+
+import (
+	"testing"
+)
+
+// scriptedMoves structure.
+// Implements MoveSource making moves by their numbers, every third move of PlayerA is automatic.
+type scriptedMoves struct {
+	rules RuleSet
+}
+
+func (m scriptedMoves) Pairs(round int, players []int64, fair Fair) ([][2]int64, []int64, error) {
+	pairs, byes := bracket(players, fair)
+
+	return pairs, byes, nil
+}
+
+func (m scriptedMoves) StartMatch(playerA, playerB int64) error {
+	return nil
+}
+
+func (m scriptedMoves) Throw(
+	round, match, number int,
+	playerA, playerB int64,
+	autoA, autoB byte,
+) (ThrowRecord, error) {
+	moves := m.rules.Moves()
+	t := ThrowRecord{MoveA: string(moves[(round+match+number)%len(moves)].Code),
+		MoveB: string(moves[(round*3+number*2)%len(moves)].Code)}
+	if number%3 == 2 {
+		t.MoveA, t.AutoA = string(autoA), true
+	}
+
+	return t, nil
+}
+
+func (m scriptedMoves) ThrowOver(t *ThrowRecord, playerA, playerB int64, winsA, winsB int) {}
+
+func (m scriptedMoves) EndMatch(playerA, playerB int64) {}
+
+// playScripted plays the game of n players by scripted moves.
+func playScripted(t *testing.T, n int, current *Options) GameRecord {
+	t.Helper()
+	game := GameRecord{GameID: 1, Rules: ClassicRules().Name(), BestOf: 3, RoundTime: 10, DrawTimeout: 20,
+		TicketPrice: 0.001, PrizeStrategy: "progressive", ServerSeed: "server", ClientSeed: "client",
+		Pot: float64(n) * 0.001}
+	for i := 1; i <= n; i++ {
+		game.Participants = append(game.Participants, Participant{UserID: int64(i)})
+	}
+
+	opts, err := game.Options(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playRounds(t, &game, &opts)
+
+	return game
+}
+
+// playRounds plays rounds of the game by scripted moves until it has a winner.
+// Prizes are recorded the way Play pays them.
+func playRounds(t *testing.T, game *GameRecord, opts *Options) {
+	t.Helper()
+	play := newEngine(game, opts, scriptedMoves{opts.rules})
+	pay := func(uid int64, result matchResult, prize float64) {
+		if (result == resultLost || result == resultFinal) && prize > 0 {
+			game.Payouts = append(game.Payouts, PayoutRecord{UserID: uid, Amount: prize})
+		}
+	}
+	players := []int64{}
+	for _, p := range game.Participants {
+		players = append(players, p.UserID)
+	}
+	for len(players) > 1 {
+		var err error
+		if players, err = play.playRound(players, pay); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReplayGame(t *testing.T) {
+	// Options differ from the ones of the game, the recorded ones must be taken
+	current := &Options{roundTime: 5, ticketPrice: 0.01, prizeStrategy: NewWinnerTakesAll(),
+		bestOf: 1, drawTimeout: 0, rules: RPSLSRules()}
+
+	for n := 2; n <= 9; n++ {
+		game := playScripted(t, n, current)
+		if game.Winner == 0 || len(game.Payouts) == 0 {
+			t.Fatalf("%d players: game isn't played", n)
+		}
+
+		replayed, err := ReplayGame(&game, current)
+		if err != nil {
+			t.Fatalf("%d players: %s", n, err)
+		}
+		if problems := CompareGames(&game, &replayed); len(problems) > 0 {
+			t.Errorf("%d players: replay differs: %v", n, problems)
+		}
+	}
+}
+
+func TestReplayGameTampered(t *testing.T) {
+	game := playScripted(t, 4, &Options{})
+
+	// Winner of the throw isn't the one its moves give
+	match := &game.Rounds[0].Matches[0]
+	if match.Throws[0].Winner == match.PlayerA {
+		match.Throws[0].Winner = match.PlayerB
+	} else {
+		match.Throws[0].Winner = match.PlayerA
+	}
+	replayed, err := ReplayGame(&game, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(CompareGames(&game, &replayed)) == 0 {
+		t.Error("tampered game is replayed the same way")
+	}
+
+	// Lost throws can't be re-run
+	game = playScripted(t, 4, &Options{})
+	game.Rounds[1].Matches[0].Throws = game.Rounds[1].Matches[0].Throws[:1]
+	if _, err := ReplayGame(&game, &Options{}); err == nil {
+		t.Error("game without throws is replayed")
+	}
+}
@@ -0,0 +1,214 @@
+package rps
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Move structure.
+// Code is the letter the move is kept with in play sequences.
+type Move struct {
+	Code  byte
+	Name  string
+	Emoji string
+}
+
+// Button returns text of the keyboard button of the move.
+func (m Move) Button() string {
+	return m.Emoji + " " + m.Name
+}
+
+// Command returns command of the move.
+func (m Move) Command() string {
+	return "/" + strings.ToLower(m.Name)
+}
+
+// Rule structure.
+// Winner move beats loser move, verb describes how.
+type Rule struct {
+	Winner byte
+	Loser  byte
+	Verb   string
+}
+
+// RuleSet structure.
+// Defines moves of the game and which of them beat each other.
+type RuleSet struct {
+	name  string
+	moves []Move
+	rules []Rule
+}
+
+// NewRuleSet creates an object of RuleSet structure.
+func NewRuleSet(name string, moves []Move, rules []Rule) RuleSet {
+	return RuleSet{name, moves, rules}
+}
+
+// ClassicRules creates rule set of Rock-Paper-Scissors.
+func ClassicRules() RuleSet {
+	return NewRuleSet(
+		"Rock-Paper-Scissors",
+		[]Move{
+			{'R', "Rock", "\U000026f0"},
+			{'P', "Paper", "\U0001f4c4"},
+			{'S', "Scissors", "\U00002702"},
+		},
+		[]Rule{
+			{'R', 'S', "crushes"},
+			{'S', 'P', "cuts"},
+			{'P', 'R', "covers"},
+		},
+	)
+}
+
+// RPSLSRules creates rule set of Rock-Paper-Scissors-Lizard-Spock.
+func RPSLSRules() RuleSet {
+	return NewRuleSet(
+		"Rock-Paper-Scissors-Lizard-Spock",
+		[]Move{
+			{'R', "Rock", "\U000026f0"},
+			{'P', "Paper", "\U0001f4c4"},
+			{'S', "Scissors", "\U00002702"},
+			{'L', "Lizard", "\U0001f98e"},
+			{'V', "Spock", "\U0001f596"},
+		},
+		[]Rule{
+			{'S', 'P', "cuts"},
+			{'P', 'R', "covers"},
+			{'R', 'L', "crushes"},
+			{'L', 'V', "poisons"},
+			{'V', 'S', "smashes"},
+			{'S', 'L', "decapitates"},
+			{'L', 'P', "eats"},
+			{'P', 'V', "disproves"},
+			{'V', 'R', "vaporizes"},
+			{'R', 'S', "crushes"},
+		},
+	)
+}
+
+// ParseRuleSet returns rule set by its short name: classic or rpsls.
+func ParseRuleSet(name string) (RuleSet, error) {
+	switch name {
+	case "classic":
+		return ClassicRules(), nil
+	case "rpsls":
+		return RPSLSRules(), nil
+	}
+
+	return RuleSet{}, fmt.Errorf("unknown rule set: %s", name)
+}
+
+// FindRuleSet returns rule set by name of its game.
+// Records made before rule sets were kept have no name and are of the classic game.
+func FindRuleSet(name string) (RuleSet, error) {
+	for _, r := range []RuleSet{ClassicRules(), RPSLSRules()} {
+		if r.Name() == name || name == "" && r.Name() == ClassicRules().Name() {
+			return r, nil
+		}
+	}
+
+	return RuleSet{}, fmt.Errorf("unknown rule set: %s", name)
+}
+
+// Name returns name of the game.
+func (r RuleSet) Name() string {
+	return r.name
+}
+
+// Moves returns all the moves of the game.
+func (r RuleSet) Moves() []Move {
+	return r.moves
+}
+
+// Move returns the move by its code.
+func (r RuleSet) Move(code byte) (Move, bool) {
+	for _, m := range r.moves {
+		if m.Code == code {
+			return m, true
+		}
+	}
+
+	return Move{}, false
+}
+
+// Beats checks if move a beats move b.
+func (r RuleSet) Beats(a, b byte) bool {
+	for _, rule := range r.rules {
+		if rule.Winner == a && rule.Loser == b {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Parse returns code of the move the text stands for.
+// Commands, names and keyboard buttons are accepted.
+func (r RuleSet) Parse(text string) (byte, bool) {
+	for _, m := range r.moves {
+		switch text {
+		case m.Command(), strings.ToLower(m.Name), m.Name, m.Button():
+			return m.Code, true
+		}
+	}
+
+	return 0, false
+}
+
+// Keyboard returns keyboard of the moves, three buttons per row.
+func (r RuleSet) Keyboard() Keyboard {
+	rows := [][]Button{}
+	texts := []string{}
+	for i, m := range r.moves {
+		texts = append(texts, m.Button())
+		if len(texts) == 3 || i == len(r.moves)-1 {
+			rows = append(rows, NewButtonRow(texts...))
+			texts = []string{}
+		}
+	}
+
+	return NewKeyboard(rows...)
+}
+
+// Description explains which moves beat each other.
+func (r RuleSet) Description() string {
+	lst := []string{}
+	for _, rule := range r.rules {
+		winner, _ := r.Move(rule.Winner)
+		loser, _ := r.Move(rule.Loser)
+		lst = append(lst, fmt.Sprintf("%s %s %s",
+			strings.ToLower(winner.Name), rule.Verb, strings.ToLower(loser.Name)))
+	}
+
+	return joinList(lst, "and")
+}
+
+// MoveNames returns names of all the moves, e.g. "rock, paper or scissors".
+func (r RuleSet) MoveNames() string {
+	lst := []string{}
+	for _, m := range r.moves {
+		lst = append(lst, strings.ToLower(m.Name))
+	}
+
+	return joinList(lst, "or")
+}
+
+// Commands returns help lines of the move commands.
+func (r RuleSet) Commands() string {
+	help := ""
+	for _, m := range r.moves {
+		help += fmt.Sprintf("%s - make a move with %s\n", m.Command(), strings.ToLower(m.Name))
+	}
+
+	return help
+}
+
+// joinList joins items with commas and the conjunction before the last one.
+func joinList(items []string, conjunction string) string {
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+
+	return strings.Join(items[:len(items)-1], ", ") + " " + conjunction + " " + items[len(items)-1]
+}
@@ -0,0 +1,708 @@
+package rps
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+var sqliteTableName = regexp.MustCompile("^[a-z_]+$")
+
+// Key of the kv table marking that LevelDB storage is imported.
+const levelDBImportedNamespace, levelDBImportedKey = "meta", "levelDBImported"
+
+const (
+	// sqliteCacheSize is a number of users kept in memory before idle ones are evicted
+	sqliteCacheSize = 10000
+	// sqliteCacheIdle is a time after which an unused user may be evicted,
+	// so users which are being changed keep being shared
+	sqliteCacheIdle = time.Hour
+)
+
+// sqlExecer is implemented by both *sql.DB and *sql.Tx.
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// SQLite structure.
+// Implements Storage on top of SQLite. Vaults of strings share a single table,
+// each vault of users gets its own indexed table and is loaded into memory on demand.
+type SQLite struct {
+	db    *sql.DB
+	path  string
+	users map[string]*SQLiteUsers
+	lock  *sync.Mutex
+}
+
+// SQLiteKV structure.
+// Implements KVStore on top of SQLite.
+type SQLiteKV struct {
+	db        *sql.DB
+	namespace string
+	batch     *[]txOp
+	lock      *sync.Mutex
+}
+
+// SQLiteUsers structure.
+// Implements UserStore on top of SQLite.
+// Recently used users are cached, the ones idle for a long time are evicted when the cache is full.
+type SQLiteUsers struct {
+	db    *sql.DB
+	table string
+	cache map[int64]*User
+	used  map[int64]time.Time
+	size  int
+	batch []txOp
+	lock  *sync.RWMutex
+}
+
+// NewSQLite creates an object of SQLite structure.
+// The driver is registered only when the bot is built with "sqlite" tag.
+func NewSQLite(dbPath string) (*SQLite, error) {
+	registered := false
+	for _, driver := range sql.Drivers() {
+		if driver == "sqlite3" {
+			registered = true
+		}
+	}
+	if !registered {
+		return nil, errors.New("sqlite support isn't compiled in, build with -tags sqlite")
+	}
+
+	if err := os.MkdirAll(dbPath, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dbPath, "rps.sqlite")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows only one writer at a time anyway
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS kv (" +
+		"namespace TEXT NOT NULL, " +
+		"key TEXT NOT NULL, " +
+		"value BLOB NOT NULL, " +
+		"PRIMARY KEY (namespace, key))")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	lock := sync.Mutex{}
+
+	return &SQLite{db, path, map[string]*SQLiteUsers{}, &lock}, nil
+}
+
+// KV opens a vault of strings.
+func (s *SQLite) KV(name string) KVStore {
+	lock := sync.Mutex{}
+
+	return SQLiteKV{s.db, name, &[]txOp{}, &lock}
+}
+
+// Users opens a vault of users.
+func (s *SQLite) Users(name string) UserStore {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if users, ok := s.users[name]; ok {
+		return users
+	}
+
+	users, err := newSQLiteUsers(s.db, name)
+	if err != nil {
+		Error.Printf("Can't open users table:\n\tDBPath: %s\n\tName: %s",
+			s.path, name)
+		panic(err)
+	}
+	s.users[name] = users
+
+	return users
+}
+
+// Update runs fn and commits all the changes it made through tx in a single transaction.
+// Nothing is written if fn returns an error.
+func (s *SQLite) Update(fn func(tx *Tx) error) error {
+	tx := &Tx{}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	sqlTx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, op := range tx.ops {
+		s.lock.Lock()
+		users, ok := s.users[op.namespace]
+		s.lock.Unlock()
+
+		if ok {
+			err = users.write(sqlTx, op)
+		} else {
+			err = sqliteKVWrite(sqlTx, op)
+		}
+		if err != nil {
+			sqlTx.Rollback()
+			return err
+		}
+	}
+	if err := sqlTx.Commit(); err != nil {
+		return err
+	}
+	tx.commit()
+
+	return nil
+}
+
+// Close closes the database.
+func (s *SQLite) Close() {
+	s.db.Close()
+}
+
+// ImportLevelDB copies LevelDB storage located at dbPath (of either the current
+// or the legacy layout) into s, so switching the backend keeps users, balances and games.
+// Import happens only once and only into an empty database, LevelDB files are left untouched.
+// Returns number of imported keys.
+func ImportLevelDB(dbPath string, s *SQLite) (int, error) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM kv").Scan(&n)
+	if err != nil || n > 0 || s.Users("users").Len() > 0 {
+		return 0, err
+	}
+
+	found := false
+	for _, dir := range append([]string{"rps"}, legacyNamespaces...) {
+		if _, err := os.Stat(filepath.Join(dbPath, dir)); err == nil {
+			found = true
+		}
+	}
+	if !found {
+		return 0, nil
+	}
+
+	path := filepath.Join(dbPath, "rps")
+	ldb, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return 0, err
+	}
+	d := DB{ldb, path}
+	defer d.Close()
+	if _, err := ImportLegacy(dbPath, d); err != nil {
+		return 0, err
+	}
+
+	err = s.Update(func(tx *Tx) error {
+		iter := d.ldb.NewIterator(nil, nil)
+		defer iter.Release()
+
+		for iter.Next() {
+			namespace, key := splitNamespaceKey(string(iter.Key()))
+			if namespace == "meta" {
+				continue
+			}
+			value := append([]byte{}, iter.Value()...)
+			// Users of older formats are migrated to the current one
+			if namespace == "users" {
+				user, err := Deserialize(value)
+				if err != nil {
+					return fmt.Errorf("can't deserialize user %s: %s", key, err)
+				}
+				value = user.Serialize()
+			}
+			tx.put(txOp{namespace: namespace, key: key, value: value}, func() {})
+		}
+		n = len(tx.ops)
+		tx.put(txOp{namespace: levelDBImportedNamespace, key: levelDBImportedKey, value: []byte("true")}, func() {})
+
+		return iter.Error()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// splitNamespaceKey splits key of LevelDB database into its namespace and the key within it.
+func splitNamespaceKey(k string) (string, string) {
+	i := strings.Index(k, ":")
+	if i < 0 {
+		return "", k
+	}
+
+	return k[:i], k[i+1:]
+}
+
+func sqliteKVWrite(e sqlExecer, op txOp) error {
+	if op.delete {
+		_, err := e.Exec("DELETE FROM kv WHERE namespace = ? AND key = ?",
+			op.namespace, op.key)
+		return err
+	}
+
+	_, err := e.Exec("INSERT INTO kv (namespace, key, value) VALUES (?, ?, ?) "+
+		"ON CONFLICT (namespace, key) DO UPDATE SET value = excluded.value",
+		op.namespace, op.key, op.value)
+
+	return err
+}
+
+// Get performs get of an object from the vault.
+func (m SQLiteKV) Get(key string) string {
+	var value []byte
+
+	err := m.db.QueryRow("SELECT value FROM kv WHERE namespace = ? AND key = ?",
+		m.namespace, key).Scan(&value)
+	if err != nil && err != sql.ErrNoRows {
+		Error.Printf("Can't get an object:\n\tName: %s\n\tKey: %s\n\t%s", m.namespace, key, err)
+	}
+
+	return string(value)
+}
+
+// Put performs put of an object into the vault.
+func (m SQLiteKV) Put(key string, value string) error {
+	return sqliteKVWrite(m.db, txOp{namespace: m.namespace, key: key, value: []byte(value)})
+}
+
+// Delete performs delete of an object from the vault.
+func (m SQLiteKV) Delete(key string) error {
+	return sqliteKVWrite(m.db, txOp{namespace: m.namespace, key: key, delete: true})
+}
+
+// Exist performs check of an object for existence in the vault.
+func (m SQLiteKV) Exist(key string) bool {
+	var one int
+
+	err := m.db.QueryRow("SELECT 1 FROM kv WHERE namespace = ? AND key = ?",
+		m.namespace, key).Scan(&one)
+	if err != nil && err != sql.ErrNoRows {
+		Error.Printf("Can't check an object:\n\tName: %s\n\tKey: %s\n\t%s", m.namespace, key, err)
+	}
+
+	return err == nil
+}
+
+// TxPut puts an object into the vault as a part of the transaction.
+func (m SQLiteKV) TxPut(tx *Tx, key string, value string) {
+	tx.put(txOp{namespace: m.namespace, key: key, value: []byte(value)}, func() {})
+}
+
+// TxDelete deletes an object from the vault as a part of the transaction.
+func (m SQLiteKV) TxDelete(tx *Tx, key string) {
+	tx.delete(txOp{namespace: m.namespace, key: key}, func() {})
+}
+
+// BatchPut puts an object into the vault by batching.
+func (m SQLiteKV) BatchPut(key string, value string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	*m.batch = append(*m.batch, txOp{namespace: m.namespace, key: key, value: []byte(value)})
+}
+
+// BatchDelete deletes an object from the vault by batching.
+func (m SQLiteKV) BatchDelete(key string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	*m.batch = append(*m.batch, txOp{namespace: m.namespace, key: key, delete: true})
+}
+
+// BatchWrite performs write of the batch to the database.
+func (m SQLiteKV) BatchWrite() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	err := sqliteBatchWrite(m.db, *m.batch, sqliteKVWrite)
+	*m.batch = []txOp{}
+
+	return err
+}
+
+// Iterate returns all the objects of the vault.
+func (m SQLiteKV) Iterate() map[string]string {
+	data := map[string]string{}
+
+	rows, err := m.db.Query("SELECT key, value FROM kv WHERE namespace = ?", m.namespace)
+	if err != nil {
+		Error.Printf("Can't iterate over the vault:\n\tName: %s\n\t%s", m.namespace, err)
+		return data
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			Error.Printf("Can't iterate over the vault:\n\tName: %s\n\t%s", m.namespace, err)
+			break
+		}
+		data[key] = string(value)
+	}
+
+	return data
+}
+
+// Len returns length of the vault
+func (m SQLiteKV) Len() int {
+	var n int
+
+	err := m.db.QueryRow("SELECT COUNT(*) FROM kv WHERE namespace = ?", m.namespace).Scan(&n)
+	if err != nil {
+		Error.Printf("Can't count objects:\n\tName: %s\n\t%s", m.namespace, err)
+	}
+
+	return n
+}
+
+func newSQLiteUsers(db *sql.DB, table string) (*SQLiteUsers, error) {
+	if !sqliteTableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+
+	schema := []string{
+		"CREATE TABLE IF NOT EXISTS " + table + " (" +
+			"user_id INTEGER PRIMARY KEY, " +
+			"name TEXT NOT NULL UNIQUE, " +
+			"has_ticket INTEGER NOT NULL, " +
+			"is_player INTEGER NOT NULL, " +
+			"total_won_amount REAL NOT NULL, " +
+			"leaderboard_position INTEGER NOT NULL, " +
+			"last_ticket_date INTEGER NOT NULL, " +
+			"join_date INTEGER NOT NULL, " +
+			"data BLOB NOT NULL)",
+		"CREATE INDEX IF NOT EXISTS " + table + "_total_won_amount " +
+			"ON " + table + " (total_won_amount DESC, join_date)",
+		"CREATE INDEX IF NOT EXISTS " + table + "_ticket " +
+			"ON " + table + " (has_ticket, last_ticket_date)",
+		"CREATE INDEX IF NOT EXISTS " + table + "_is_player " +
+			"ON " + table + " (is_player)",
+	}
+	for _, query := range schema {
+		if _, err := db.Exec(query); err != nil {
+			return nil, err
+		}
+	}
+
+	lock := sync.RWMutex{}
+
+	return &SQLiteUsers{db, table, map[int64]*User{}, map[int64]time.Time{}, sqliteCacheSize, []txOp{}, &lock}, nil
+}
+
+// Get performs get of an object from the vault.
+// Users are loaded from the database once and cached afterwards.
+func (m *SQLiteUsers) Get(uid int64) *User {
+	(*m.lock).Lock()
+	defer (*m.lock).Unlock()
+
+	user, err := m.load(uid)
+	if err != nil && err != sql.ErrNoRows {
+		Error.Printf("Can't load user:\n\tUserID: %d\n\t%s", uid, err)
+	}
+
+	return user
+}
+
+// Put performs put of an object into the vault.
+func (m *SQLiteUsers) Put(uid int64, user *User) error {
+	(*m.lock).Lock()
+	defer (*m.lock).Unlock()
+
+	err := m.write(m.db, txOp{namespace: m.table, key: strconv.FormatInt(uid, 10), value: user.Serialize()})
+	if err != nil {
+		return err
+	}
+	m.cachePut(uid, user)
+
+	return nil
+}
+
+// Delete performs delete of an object from the vault.
+func (m *SQLiteUsers) Delete(uid int64) error {
+	(*m.lock).Lock()
+	defer (*m.lock).Unlock()
+
+	err := m.write(m.db, txOp{namespace: m.table, key: strconv.FormatInt(uid, 10), delete: true})
+	if err != nil {
+		return err
+	}
+	m.cacheDelete(uid)
+
+	return nil
+}
+
+// Exist performs check of an object for existence in the vault.
+func (m *SQLiteUsers) Exist(uid int64) bool {
+	(*m.lock).RLock()
+	_, ok := m.cache[uid]
+	(*m.lock).RUnlock()
+	if ok {
+		return true
+	}
+
+	var one int
+	err := m.db.QueryRow("SELECT 1 FROM "+m.table+" WHERE user_id = ?", uid).Scan(&one)
+	if err != nil && err != sql.ErrNoRows {
+		Error.Printf("Can't check user:\n\tUserID: %d\n\t%s", uid, err)
+	}
+
+	return err == nil
+}
+
+// TxPut puts an object into the vault as a part of the transaction.
+func (m *SQLiteUsers) TxPut(tx *Tx, uid int64, user *User) {
+	op := txOp{namespace: m.table, key: strconv.FormatInt(uid, 10), value: user.Serialize()}
+	tx.put(op, func() {
+		(*m.lock).Lock()
+		defer (*m.lock).Unlock()
+		m.cachePut(uid, user)
+	})
+}
+
+// TxDelete deletes an object from the vault as a part of the transaction.
+func (m *SQLiteUsers) TxDelete(tx *Tx, uid int64) {
+	tx.delete(txOp{namespace: m.table, key: strconv.FormatInt(uid, 10)}, func() {
+		(*m.lock).Lock()
+		defer (*m.lock).Unlock()
+		m.cacheDelete(uid)
+	})
+}
+
+// BatchPut puts an object into the vault by batching.
+func (m *SQLiteUsers) BatchPut(uid int64, user *User) {
+	(*m.lock).Lock()
+	defer (*m.lock).Unlock()
+
+	m.batch = append(m.batch, txOp{namespace: m.table, key: strconv.FormatInt(uid, 10), value: user.Serialize()})
+	m.cachePut(uid, user)
+}
+
+// BatchDelete deletes an object from the vault by batching.
+func (m *SQLiteUsers) BatchDelete(uid int64) {
+	(*m.lock).Lock()
+	defer (*m.lock).Unlock()
+
+	m.batch = append(m.batch, txOp{namespace: m.table, key: strconv.FormatInt(uid, 10), delete: true})
+	m.cacheDelete(uid)
+}
+
+// BatchWrite performs write of the batch to the database.
+func (m *SQLiteUsers) BatchWrite() error {
+	(*m.lock).Lock()
+	defer (*m.lock).Unlock()
+
+	err := sqliteBatchWrite(m.db, m.batch, m.write)
+	m.batch = []txOp{}
+
+	return err
+}
+
+// Len returns length of the vault
+func (m *SQLiteUsers) Len() int {
+	var n int
+
+	if err := m.db.QueryRow("SELECT COUNT(*) FROM " + m.table).Scan(&n); err != nil {
+		Error.Printf("Can't count users:\n\t%s", err)
+	}
+
+	return n
+}
+
+// Players returns users taking part in the game.
+func (m *SQLiteUsers) Players() []*User {
+	return m.query("SELECT user_id FROM " + m.table + " WHERE is_player = 1")
+}
+
+// TicketHolders returns users having a ticket
+// sorted by last ticket purchase date, the most recent first.
+func (m *SQLiteUsers) TicketHolders() []*User {
+	return m.query("SELECT user_id FROM " + m.table +
+		" WHERE has_ticket = 1 ORDER BY last_ticket_date DESC")
+}
+
+// UpdateLeaderboard recalculates leaderboard positions of all the users
+// and returns the first n of the leaderboard.
+func (m *SQLiteUsers) UpdateLeaderboard(n int) []*User {
+	_, err := m.db.Exec("UPDATE " + m.table + " SET leaderboard_position = r.position FROM (" +
+		"SELECT user_id, ROW_NUMBER() OVER (ORDER BY total_won_amount DESC, join_date) AS position " +
+		"FROM " + m.table + ") AS r WHERE " + m.table + ".user_id = r.user_id")
+	if err != nil {
+		Error.Printf("Can't update leaderboard positions.\n\t%s", err)
+	}
+
+	// Refresh positions of the users which are in memory already
+	cached := map[int64]*User{}
+	(*m.lock).RLock()
+	for uid, user := range m.cache {
+		cached[uid] = user
+	}
+	(*m.lock).RUnlock()
+
+	rows, err := m.db.Query("SELECT user_id, leaderboard_position FROM " + m.table)
+	if err != nil {
+		Error.Printf("Can't refresh leaderboard positions.\n\t%s", err)
+	} else {
+		for rows.Next() {
+			var uid int64
+			var position uint32
+			if err := rows.Scan(&uid, &position); err != nil {
+				Error.Printf("Can't refresh leaderboard positions.\n\t%s", err)
+				break
+			}
+			if user, ok := cached[uid]; ok {
+				user.SetLeaderboardPosition(position)
+			}
+		}
+		rows.Close()
+	}
+
+	return m.query(fmt.Sprintf("SELECT user_id FROM %s ORDER BY leaderboard_position LIMIT %d",
+		m.table, n))
+}
+
+// query returns users whose IDs are selected by the query in the same order.
+func (m *SQLiteUsers) query(query string) []*User {
+	lst := []*User{}
+
+	rows, err := m.db.Query(query)
+	if err != nil {
+		Error.Printf("Can't query users:\n\t%s", err)
+		return lst
+	}
+	uids := []int64{}
+	for rows.Next() {
+		var uid int64
+		if err := rows.Scan(&uid); err != nil {
+			Error.Printf("Can't query users:\n\t%s", err)
+			break
+		}
+		uids = append(uids, uid)
+	}
+	rows.Close()
+
+	for _, uid := range uids {
+		if user := m.Get(uid); user != nil {
+			lst = append(lst, user)
+		}
+	}
+
+	return lst
+}
+
+// load returns cached user or loads it from the database. Must be called with the lock held.
+func (m *SQLiteUsers) load(uid int64) (*User, error) {
+	if user, ok := m.cache[uid]; ok {
+		m.used[uid] = time.Now()
+		return user, nil
+	}
+
+	var data []byte
+	var position uint32
+	err := m.db.QueryRow("SELECT data, leaderboard_position FROM "+m.table+" WHERE user_id = ?",
+		uid).Scan(&data, &position)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := Deserialize(data)
+	if err != nil {
+		return nil, err
+	}
+	// Positions are updated in the column only
+	user.SetLeaderboardPosition(position)
+	m.cachePut(uid, &user)
+
+	return &user, nil
+}
+
+// cachePut caches the user and evicts idle users if the cache is full. Must be called with the lock held.
+func (m *SQLiteUsers) cachePut(uid int64, user *User) {
+	m.cache[uid] = user
+	m.used[uid] = time.Now()
+	if len(m.cache) <= m.size {
+		return
+	}
+
+	// A quarter of the cache is freed at once, so eviction doesn't run on every load
+	idle := []int64{}
+	for id, t := range m.used {
+		if time.Since(t) > sqliteCacheIdle {
+			idle = append(idle, id)
+		}
+	}
+	sort.Slice(idle, func(i, j int) bool { return m.used[idle[i]].Before(m.used[idle[j]]) })
+	for _, id := range idle {
+		if len(m.cache) <= m.size*3/4 {
+			break
+		}
+		m.cacheDelete(id)
+	}
+}
+
+// cacheDelete removes the user from the cache. Must be called with the lock held.
+func (m *SQLiteUsers) cacheDelete(uid int64) {
+	delete(m.cache, uid)
+	delete(m.used, uid)
+}
+
+func (m *SQLiteUsers) write(e sqlExecer, op txOp) error {
+	if op.delete {
+		_, err := e.Exec("DELETE FROM "+m.table+" WHERE user_id = ?", op.key)
+		return err
+	}
+
+	user, err := Deserialize(op.value)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.Exec("INSERT INTO "+m.table+" (user_id, name, has_ticket, is_player, "+
+		"total_won_amount, leaderboard_position, last_ticket_date, join_date, data) "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (user_id) DO UPDATE SET "+
+		"name = excluded.name, has_ticket = excluded.has_ticket, "+
+		"is_player = excluded.is_player, total_won_amount = excluded.total_won_amount, "+
+		"leaderboard_position = excluded.leaderboard_position, "+
+		"last_ticket_date = excluded.last_ticket_date, join_date = excluded.join_date, "+
+		"data = excluded.data",
+		user.GetUserID(), user.GetName(), user.GetHasTicket(), user.GetIsPlayer(),
+		user.GetTotalWonAmount(), user.GetLeaderboardPosition(),
+		sqliteTime(user.GetLastTicketDate()), sqliteTime(user.GetJoinDate()), op.value)
+
+	return err
+}
+
+func sqliteBatchWrite(db *sql.DB, batch []txOp, write func(e sqlExecer, op txOp) error) error {
+	sqlTx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, op := range batch {
+		if err := write(sqlTx, op); err != nil {
+			sqlTx.Rollback()
+			return err
+		}
+	}
+
+	return sqlTx.Commit()
+}
+
+// sqliteTime converts time to nanoseconds keeping zero time the smallest.
+func sqliteTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixNano()
+}
@@ -0,0 +1,8 @@
+//go:build sqlite
+// +build sqlite
+
+package rps
+
+// SQLite driver requires cgo, so it's linked in only on demand:
+// go build -tags sqlite
+import _ "github.com/mattn/go-sqlite3"
@@ -0,0 +1,133 @@
+//go:build sqlite
+// +build sqlite
+
+package rps
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// openTestSQLiteUsers opens vault of users of SQLite storage in a temporary directory.
+func openTestSQLiteUsers(t *testing.T) *SQLiteUsers {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "rps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewSQLite(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		storage.Close()
+		os.RemoveAll(dir)
+	})
+
+	return storage.Users("users").(*SQLiteUsers)
+}
+
+func TestSQLiteUsersCacheEviction(t *testing.T) {
+	users := openTestSQLiteUsers(t)
+	users.size = 4
+
+	for uid := int64(1); uid <= 8; uid++ {
+		user := NewUser(uid, fmt.Sprintf("user%d", uid), true, false, false, 0)
+		if err := users.Put(uid, &user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Users which were used recently are kept even if the cache is full
+	if len(users.cache) != 8 {
+		t.Fatalf("%d users cached, 8 expected", len(users.cache))
+	}
+
+	for uid := int64(1); uid <= 6; uid++ {
+		users.used[uid] = time.Now().Add(-2 * sqliteCacheIdle)
+	}
+	kept := users.Get(8)
+	if err := users.Put(7, users.Get(7)); err != nil {
+		t.Fatal(err)
+	}
+	if len(users.cache) != 3 {
+		t.Fatalf("%d users cached, 3 expected", len(users.cache))
+	}
+	if users.Get(8) != kept {
+		t.Error("recently used user is evicted")
+	}
+	if user := users.Get(1); user == nil || user.GetName() != "user1" {
+		t.Error("evicted user isn't loaded again")
+	}
+}
+
+func TestSQLiteUsersUpdateLeaderboard(t *testing.T) {
+	users := openTestSQLiteUsers(t)
+
+	for uid := int64(1); uid <= 3; uid++ {
+		user := NewUser(uid, fmt.Sprintf("user%d", uid), true, false, false, 0)
+		user.SetTotalWonAmount(float64(uid))
+		if err := users.Put(uid, &user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	top := users.UpdateLeaderboard(2)
+	if len(top) != 2 || top[0].GetUserID() != 3 || top[1].GetUserID() != 2 {
+		t.Fatalf("unexpected leaderboard %v", top)
+	}
+	for uid := int64(1); uid <= 3; uid++ {
+		if pos := users.Get(uid).GetLeaderboardPosition(); pos != uint32(4-uid) {
+			t.Errorf("user %d is at %d, %d expected", uid, pos, 4-uid)
+		}
+	}
+}
+
+func TestSQLiteImportLevelDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := NewDB(dir)
+	user := NewUser(1, "user1", true, false, false, 0)
+	user.SetBalance(0.005)
+	if err := db.Users("users").Put(1, &user); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.KV("games").Put("1", "game"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	storage, err := OpenStorage("sqlite", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported := storage.Users("users").Get(1)
+	if imported == nil || imported.GetName() != "user1" || imported.GetBalance() != 0.005 {
+		t.Fatalf("user is imported as %v", imported)
+	}
+	if game := storage.KV("games").Get("1"); game != "game" {
+		t.Errorf("game is imported as %q", game)
+	}
+	storage.Close()
+
+	// Database is imported only once
+	db = NewDB(dir)
+	if err := db.KV("games").Put("2", "game"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	storage, err = OpenStorage("sqlite", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	if storage.KV("games").Exist("2") {
+		t.Error("database is imported again")
+	}
+}
@@ -0,0 +1,144 @@
+package rps
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Storage describes a database backend of the bot.
+// Each vault lives in its own namespace of the storage.
+type Storage interface {
+	// KV opens a vault of strings.
+	KV(name string) KVStore
+	// Users opens a vault of users.
+	Users(name string) UserStore
+	// Update runs fn and commits all the changes it made through tx atomically.
+	// Nothing is written if fn returns an error.
+	Update(fn func(tx *Tx) error) error
+	// Close closes the storage.
+	Close()
+}
+
+// KVStore describes a vault of strings.
+type KVStore interface {
+	Get(key string) string
+	Put(key string, value string) error
+	Delete(key string) error
+	Exist(key string) bool
+	TxPut(tx *Tx, key string, value string)
+	TxDelete(tx *Tx, key string)
+	BatchPut(key string, value string)
+	BatchDelete(key string)
+	BatchWrite() error
+	Iterate() map[string]string
+	Len() int
+}
+
+// UserStore describes a vault of users.
+// The same *User is returned for the same user while it stays in the vault,
+// so changes made by one goroutine are seen by the others.
+type UserStore interface {
+	Get(uid int64) *User
+	Put(uid int64, user *User) error
+	Delete(uid int64) error
+	Exist(uid int64) bool
+	TxPut(tx *Tx, uid int64, user *User)
+	TxDelete(tx *Tx, uid int64)
+	BatchPut(uid int64, user *User)
+	BatchDelete(uid int64)
+	BatchWrite() error
+	Len() int
+
+	// Players returns users taking part in the game.
+	Players() []*User
+	// TicketHolders returns users having a ticket
+	// sorted by last ticket purchase date, the most recent first.
+	TicketHolders() []*User
+	// UpdateLeaderboard recalculates leaderboard positions of all the users
+	// and returns the first n of the leaderboard.
+	UpdateLeaderboard(n int) []*User
+}
+
+// Tx structure.
+// Collects changes of several vaults to commit them atomically.
+type Tx struct {
+	ops     []txOp
+	commits []func()
+}
+
+// txOp is a single change of a transaction.
+type txOp struct {
+	namespace string
+	key       string
+	value     []byte
+	delete    bool
+}
+
+// put schedules write of the key and the in-memory change applied after commit.
+func (tx *Tx) put(op txOp, commit func()) {
+	tx.ops = append(tx.ops, op)
+	tx.commits = append(tx.commits, commit)
+}
+
+// delete schedules deletion of the key and the in-memory change applied after commit.
+func (tx *Tx) delete(op txOp, commit func()) {
+	op.delete = true
+	tx.ops = append(tx.ops, op)
+	tx.commits = append(tx.commits, commit)
+}
+
+func (tx *Tx) commit() {
+	for _, commit := range tx.commits {
+		commit()
+	}
+}
+
+// OpenStorage opens storage of the backend ("leveldb" or "sqlite") located at dbPath.
+func OpenStorage(backend string, dbPath string) (Storage, error) {
+	switch backend {
+	case "leveldb":
+		db := NewDB(dbPath)
+		n, err := ImportLegacy(dbPath, db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		if n > 0 {
+			Info.Printf("%d records imported from databases of the legacy layout", n)
+		}
+		return db, nil
+	case "sqlite":
+		s, err := NewSQLite(dbPath)
+		if err != nil {
+			return nil, err
+		}
+		n, err := ImportLevelDB(dbPath, s)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		if n > 0 {
+			Info.Printf("%d records imported from LevelDB database", n)
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// nextCounter increments the counter kept under the key of the vault and returns its new value.
+func nextCounter(kv KVStore, key string) (uint64, error) {
+	var n uint64
+	if v := kv.Get(key); v != "" {
+		var err error
+		if n, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	n++
+	if err := kv.Put(key, strconv.FormatUint(n, 10)); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,156 @@
+package rps
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Syfaro/telegram-bot-api"
+)
+
+// DefaultAPIURL is the base URL of the official Telegram Bot API.
+const DefaultAPIURL = "https://api.telegram.org"
+
+// Telegram structure.
+// Implements Transport on top of Telegram Bot API.
+type Telegram struct {
+	botAPI *tgbotapi.BotAPI
+	stop   chan struct{}
+	once   *sync.Once
+}
+
+// NewTelegram creates an object of Telegram structure authorized with the token.
+// API URL allows to point the bot to a local Bot API server e.g. in tests.
+func NewTelegram(token string, apiURL string) (Telegram, error) {
+	client := &http.Client{}
+	if apiURL != "" && apiURL != DefaultAPIURL {
+		base, err := url.Parse(apiURL)
+		if err != nil {
+			return Telegram{}, err
+		}
+		client.Transport = endpointTransport{base, http.DefaultTransport}
+	}
+
+	botAPI, err := tgbotapi.NewBotAPIWithClient(token, client)
+	if err != nil {
+		return Telegram{}, err
+	}
+
+	Info.Printf("Authorized on account %s", botAPI.Self.UserName)
+
+	return Telegram{botAPI, make(chan struct{}), &sync.Once{}}, nil
+}
+
+// Close stops receiving updates, so the bot's update loop ends.
+func (t Telegram) Close() {
+	t.once.Do(func() {
+		t.botAPI.StopReceivingUpdates()
+		close(t.stop)
+	})
+}
+
+// Send sends text message with keyboard to the chat.
+func (t Telegram) Send(chatID int64, text string, keyboard Keyboard) error {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "markdown"
+	if len(keyboard.Rows) > 0 {
+		msg.ReplyMarkup = telegramMarkup(keyboard)
+	}
+
+	_, err := t.botAPI.Send(msg)
+
+	return err
+}
+
+// Updates returns channel of inbound messages and callbacks.
+// Callback queries are answered right away to stop the client's spinner.
+func (t Telegram) Updates() (<-chan Update, error) {
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+
+	tgUpdates, err := t.botAPI.GetUpdatesChan(u)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(chan Update, 100)
+	go func() {
+		defer close(updates)
+		for {
+			var update tgbotapi.Update
+			select {
+			case update = <-tgUpdates:
+			case <-t.stop:
+				return
+			}
+
+			if update.Message != nil {
+				updates <- Update{
+					ChatID:   update.Message.Chat.ID,
+					UserName: update.Message.Chat.UserName,
+					Text:     update.Message.Text,
+				}
+			}
+
+			if update.CallbackQuery != nil && update.CallbackQuery.Message != nil {
+				if _, err := t.botAPI.AnswerCallbackQuery(
+					tgbotapi.NewCallback(update.CallbackQuery.ID, ""),
+				); err != nil {
+					Warning.Printf("Can't answer callback query:\n\t%s", err)
+				}
+				updates <- Update{
+					ChatID:   update.CallbackQuery.Message.Chat.ID,
+					UserName: update.CallbackQuery.Message.Chat.UserName,
+					Text:     update.CallbackQuery.Data,
+					Callback: true,
+				}
+			}
+		}
+	}()
+
+	return updates, nil
+}
+
+func telegramMarkup(keyboard Keyboard) interface{} {
+	if keyboard.Inline {
+		rows := [][]tgbotapi.InlineKeyboardButton{}
+		for _, row := range keyboard.Rows {
+			buttons := []tgbotapi.InlineKeyboardButton{}
+			for _, button := range row {
+				buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(button.Text, button.Data))
+			}
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(buttons...))
+		}
+
+		return tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+
+	rows := [][]tgbotapi.KeyboardButton{}
+	for _, row := range keyboard.Rows {
+		buttons := []tgbotapi.KeyboardButton{}
+		for _, button := range row {
+			buttons = append(buttons, tgbotapi.NewKeyboardButton(button.Text))
+		}
+		rows = append(rows, tgbotapi.NewKeyboardButtonRow(buttons...))
+	}
+
+	return tgbotapi.NewReplyKeyboard(rows...)
+}
+
+// endpointTransport redirects requests of the Bot API client to another base URL,
+// since the endpoint is a constant in tgbotapi.
+type endpointTransport struct {
+	base *url.URL
+	next http.RoundTripper
+}
+
+func (t endpointTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = t.base.Scheme
+	r.URL.Host = t.base.Host
+	r.URL.Path = strings.TrimSuffix(t.base.Path, "/") + req.URL.Path
+	r.Host = ""
+
+	return t.next.RoundTrip(r)
+}
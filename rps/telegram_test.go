@@ -0,0 +1,75 @@
+package rps
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron"
+	"github.com/rps-bot/rpsbot/rps/telegramtest"
+)
+
+// waitTelegramMessage waits until the bot sends to the chat a message containing text and returns it.
+func waitTelegramMessage(t *testing.T, server *telegramtest.Server, chatID int64, text string) telegramtest.Message {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		for _, msg := range server.Messages(chatID) {
+			if strings.Contains(msg.Text, text) {
+				return msg
+			}
+		}
+	}
+	t.Fatalf("chat %d didn't get %q", chatID, text)
+
+	return telegramtest.Message{}
+}
+
+func TestBotStartWithTelegram(t *testing.T) {
+	server := telegramtest.NewServer("token")
+	defer server.Close()
+	telegram, err := NewTelegram("token", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewOptions(128, 0, 0, 60, 1, 5, "0 0 0 1 1 *", 0.001, "", 0.002, 0, 0,
+		NewProgressiveRefund(0.001), 0, 0, "", 1, 2, ClassicRules(), false)
+	leaderboard := []*User{}
+	b := New(telegram, &opts, cron.New(), NewFakeWallet(0), NewFakeWallet(0),
+		openTestStorage(t), []int64{}, &leaderboard)
+	done := make(chan struct{})
+	go func() {
+		b.Start()
+		close(done)
+	}()
+	// Bot is stopped before its storage is closed
+	defer func() {
+		telegram.Close()
+		<-done
+	}()
+
+	server.PushMessage(1, "user1", "/start")
+	msg := waitTelegramMessage(t, server, 1, "You're now subscribed!")
+	if msg.ParseMode != "markdown" || !strings.Contains(msg.ReplyMarkup, "BuyTicket") {
+		t.Errorf("reply is sent as %q with keyboard %q", msg.ParseMode, msg.ReplyMarkup)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	server.PushMessage(1, "user1", "/buyticket")
+	msg = waitTelegramMessage(t, server, 1, "How many tickets")
+	if !strings.Contains(msg.ReplyMarkup, "inline_keyboard") {
+		t.Errorf("ticket count is asked with keyboard %q", msg.ReplyMarkup)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// Button press is answered and handled as a callback
+	id := server.PushCallback(1, "user1", "tickets 1")
+	waitTelegramMessage(t, server, 1, "to pay")
+	answered := false
+	for _, a := range server.Answered() {
+		answered = answered || a == id
+	}
+	if !answered {
+		t.Errorf("callback query %s isn't answered", id)
+	}
+}
@@ -0,0 +1,276 @@
+// Package telegramtest provides a local stand-in of the Telegram Bot API
+// for integration tests of the bot.
+package telegramtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Syfaro/telegram-bot-api"
+)
+
+// Message structure.
+// A message sent by the bot through sendMessage.
+type Message struct {
+	ChatID      int64
+	Text        string
+	ParseMode   string
+	ReplyMarkup string
+}
+
+// Server structure.
+// Serves getMe, getUpdates, sendMessage and answerCallbackQuery
+// for a single bot token.
+type Server struct {
+	URL string
+
+	server        *httptest.Server
+	token         string
+	updates       []tgbotapi.Update
+	sent          []Message
+	answered      []string
+	nextUpdateID  int
+	nextMessageID int
+	notify        chan struct{}
+	done          chan struct{}
+	closeOnce     *sync.Once
+	lock          *sync.Mutex
+}
+
+// NewServer starts a server accepting requests for the token.
+// Pass its URL as API URL of rps.NewTelegram.
+func NewServer(token string) *Server {
+	lock := sync.Mutex{}
+	s := &Server{
+		token:         token,
+		updates:       []tgbotapi.Update{},
+		sent:          []Message{},
+		answered:      []string{},
+		nextUpdateID:  1,
+		nextMessageID: 1,
+		notify:        make(chan struct{}),
+		done:          make(chan struct{}),
+		closeOnce:     &sync.Once{},
+		lock:          &lock,
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+
+	return s
+}
+
+// Close shuts the server down, interrupting pending long polls.
+// Calling it again does nothing.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.server.Close()
+	})
+}
+
+// PushMessage queues a text message from the user as if it was typed in the chat.
+func (s *Server) PushMessage(chatID int64, userName string, text string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.updates = append(s.updates, tgbotapi.Update{
+		UpdateID: s.nextUpdateID,
+		Message:  s.newMessage(chatID, userName, text),
+	})
+	s.nextUpdateID++
+	s.wake()
+}
+
+// PushCallback queues a press of an inline button carrying the data.
+// Returns ID of the callback query.
+func (s *Server) PushCallback(chatID int64, userName string, data string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id := strconv.Itoa(s.nextUpdateID)
+	s.updates = append(s.updates, tgbotapi.Update{
+		UpdateID: s.nextUpdateID,
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:      id,
+			From:    &tgbotapi.User{ID: int(chatID), UserName: userName},
+			Message: s.newMessage(chatID, userName, ""),
+			Data:    data,
+		},
+	})
+	s.nextUpdateID++
+	s.wake()
+
+	return id
+}
+
+// Messages returns every message sent by the bot to the chat in order of sending.
+func (s *Server) Messages(chatID int64) []Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	lst := []Message{}
+	for _, msg := range s.sent {
+		if msg.ChatID == chatID {
+			lst = append(lst, msg)
+		}
+	}
+
+	return lst
+}
+
+// WaitMessages waits until the bot sends at least n messages to the chat.
+// Returns the messages sent so far and false if timeout has expired.
+func (s *Server) WaitMessages(chatID int64, n int, timeout time.Duration) ([]Message, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		lst := s.Messages(chatID)
+		if len(lst) >= n {
+			return lst, true
+		}
+		if time.Now().After(deadline) {
+			return lst, false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Answered returns IDs of answered callback queries.
+func (s *Server) Answered() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	lst := make([]string, len(s.answered))
+	copy(lst, s.answered)
+
+	return lst
+}
+
+func (s *Server) newMessage(chatID int64, userName string, text string) *tgbotapi.Message {
+	msg := &tgbotapi.Message{
+		MessageID: s.nextMessageID,
+		From:      &tgbotapi.User{ID: int(chatID), UserName: userName},
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private", UserName: userName},
+		Text:      text,
+	}
+	s.nextMessageID++
+
+	return msg
+}
+
+// wake releases pending long polls. Must be called with the lock held.
+func (s *Server) wake() {
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	prefix := "/bot" + s.token + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		respond(w, http.StatusUnauthorized, false, nil, "Unauthorized")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		respond(w, http.StatusBadRequest, false, nil, err.Error())
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, prefix) {
+	case "getMe":
+		respond(w, http.StatusOK, true, tgbotapi.User{
+			ID:        1,
+			FirstName: "rpsbot",
+			UserName:  "rpsbot",
+			IsBot:     true,
+		}, "")
+	case "getUpdates":
+		s.getUpdates(w, r)
+	case "sendMessage":
+		s.sendMessage(w, r)
+	case "answerCallbackQuery":
+		s.lock.Lock()
+		s.answered = append(s.answered, r.FormValue("callback_query_id"))
+		s.lock.Unlock()
+		respond(w, http.StatusOK, true, true, "")
+	default:
+		respond(w, http.StatusNotFound, false, nil, "Not Found")
+	}
+}
+
+func (s *Server) getUpdates(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.FormValue("offset"))
+	timeout, _ := strconv.Atoi(r.FormValue("timeout"))
+	deadline := time.After(time.Duration(timeout) * time.Second)
+
+	for {
+		s.lock.Lock()
+		lst := []tgbotapi.Update{}
+		for _, update := range s.updates {
+			if update.UpdateID >= offset {
+				lst = append(lst, update)
+			}
+		}
+		notify := s.notify
+		s.lock.Unlock()
+
+		if len(lst) > 0 {
+			respond(w, http.StatusOK, true, lst, "")
+			return
+		}
+
+		select {
+		case <-notify:
+		case <-deadline:
+			respond(w, http.StatusOK, true, lst, "")
+			return
+		case <-s.done:
+			respond(w, http.StatusOK, true, lst, "")
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) sendMessage(w http.ResponseWriter, r *http.Request) {
+	chatID, err := strconv.ParseInt(r.FormValue("chat_id"), 10, 64)
+	if err != nil {
+		respond(w, http.StatusBadRequest, false, nil, "Bad Request: chat not found")
+		return
+	}
+	if r.FormValue("text") == "" {
+		respond(w, http.StatusBadRequest, false, nil, "Bad Request: message text is empty")
+		return
+	}
+
+	s.lock.Lock()
+	s.sent = append(s.sent, Message{
+		chatID,
+		r.FormValue("text"),
+		r.FormValue("parse_mode"),
+		r.FormValue("reply_markup"),
+	})
+	msg := s.newMessage(chatID, "", r.FormValue("text"))
+	s.lock.Unlock()
+
+	respond(w, http.StatusOK, true, msg, "")
+}
+
+func respond(w http.ResponseWriter, code int, ok bool, result interface{}, description string) {
+	resp := map[string]interface{}{"ok": ok}
+	if ok {
+		resp["result"] = result
+	} else {
+		resp["error_code"] = code
+		resp["description"] = description
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,35 @@
+package telegramtest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServerClose(t *testing.T) {
+	s := NewServer("token")
+
+	// Pending long poll is interrupted by Close
+	polled := make(chan error)
+	go func() {
+		resp, err := http.Get(s.URL + "/bottoken/getUpdates?timeout=60")
+		if err == nil {
+			resp.Body.Close()
+		}
+		polled <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	s.Close()
+	select {
+	case err := <-polled:
+		if err != nil {
+			t.Errorf("long poll failed: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll isn't interrupted")
+	}
+
+	// Server can be closed by the test and by its cleanup
+	s.Close()
+}
@@ -0,0 +1,52 @@
+package rps
+
+// Transport describes a messenger front-end of the bot.
+type Transport interface {
+	// Send sends text message with keyboard to the chat.
+	Send(chatID int64, text string, keyboard Keyboard) error
+	// Updates returns channel of inbound messages and callbacks.
+	Updates() (<-chan Update, error)
+}
+
+// Update structure.
+// Transport-neutral inbound message or callback.
+type Update struct {
+	ChatID   int64
+	UserName string
+	Text     string
+	Callback bool
+}
+
+// Button structure.
+// Data is sent back in a callback when the button is inline.
+type Button struct {
+	Text string
+	Data string
+}
+
+// Keyboard structure.
+// Inline keyboards are attached to a message, the others replace user's keyboard.
+type Keyboard struct {
+	Inline bool
+	Rows   [][]Button
+}
+
+// NewKeyboard creates a reply keyboard with rows of buttons.
+func NewKeyboard(rows ...[]Button) Keyboard {
+	return Keyboard{false, rows}
+}
+
+// NewInlineKeyboard creates an inline keyboard with rows of buttons.
+func NewInlineKeyboard(rows ...[]Button) Keyboard {
+	return Keyboard{true, rows}
+}
+
+// NewButtonRow creates a row of buttons with given texts.
+func NewButtonRow(texts ...string) []Button {
+	row := make([]Button, len(texts))
+	for i, text := range texts {
+		row[i] = Button{text, text}
+	}
+
+	return row
+}
@@ -1,7 +1,6 @@
 package rps
 
 import (
-	"path/filepath"
 	"strconv"
 	"sync"
 
@@ -13,24 +12,18 @@ type UMap struct {
 	data  map[int64]*User
 	lock  *sync.RWMutex
 	name  string
-	db    *leveldb.DB
+	db    DB
 	batch *leveldb.Batch
 }
 
 // NewUMap creates an object of UMap structure.
-func NewUMap(name string, dbPath string) UMap {
+// Name is the namespace of the vault in the database.
+func NewUMap(name string, db DB) UMap {
 	lock := sync.RWMutex{}
 	data := map[int64]*User{}
-	db, err := leveldb.OpenFile(filepath.Join(dbPath, name), nil)
-	if err != nil {
-		Error.Printf("Can't get access to database:\n\tDBPath: %s",
-			filepath.Join(dbPath, name))
-		panic(err)
-	}
 
-	iter := db.NewIterator(nil, nil)
-	for iter.Next() {
-		_k, _v := iter.Key(), iter.Value()
+	batch := new(leveldb.Batch)
+	err := db.namespaceIterate(name, func(_k []byte, _v []byte) {
 		uid, err := strconv.ParseInt(string(_k), 10, 64)
 		if err != nil {
 			Error.Printf("Can't parse user ID:\n\tUserID: %s",
@@ -44,9 +37,28 @@ func NewUMap(name string, dbPath string) UMap {
 			panic(err)
 		}
 		data[uid] = &user
+
+		// Migrate records of older formats to the current one
+		if userRecordVersion(_v) != userFormatVersion {
+			batch.Put(namespaceKey(name, string(_k)), user.Serialize())
+		}
+	})
+	if err != nil {
+		Error.Printf("Can't load vault from database:\n\tDBPath: %s\n\tName: %s",
+			db.path, name)
+		panic(err)
+	}
+
+	if batch.Len() > 0 {
+		if err := db.ldb.Write(batch, nil); err != nil {
+			Error.Printf("Can't migrate users to the current format:\n\tDBPath: %s",
+				db.path)
+			panic(err)
+		}
+		Info.Printf("%d users migrated to the format version %d", batch.Len(), userFormatVersion)
+		batch.Reset()
 	}
 
-	batch := new(leveldb.Batch)
 	UMap := UMap{data, &lock, name, db, batch}
 
 	return UMap
@@ -67,7 +79,7 @@ func (m UMap) Put(uid int64, user *User) error {
 	strUID := strconv.FormatInt(uid, 10)
 	strUser := user.Serialize()
 
-	err := m.db.Put([]byte(strUID), strUser, nil)
+	err := m.db.ldb.Put(namespaceKey(m.name, strUID), strUser, nil)
 	if err != nil {
 		return err
 	}
@@ -83,7 +95,7 @@ func (m UMap) Delete(uid int64) error {
 
 	strUID := strconv.FormatInt(uid, 10)
 
-	err := m.db.Delete([]byte(strUID), nil)
+	err := m.db.ldb.Delete(namespaceKey(m.name, strUID), nil)
 	if err != nil {
 		return err
 	}
@@ -102,6 +114,26 @@ func (m UMap) Exist(uid int64) bool {
 	return ok
 }
 
+// TxPut puts an object into the vault as a part of the transaction.
+func (m UMap) TxPut(tx *Tx, uid int64, user *User) {
+	strUID := strconv.FormatInt(uid, 10)
+	tx.put(txOp{namespace: m.name, key: strUID, value: user.Serialize()}, func() {
+		(*m.lock).Lock()
+		defer (*m.lock).Unlock()
+		m.data[uid] = user
+	})
+}
+
+// TxDelete deletes an object from the vault as a part of the transaction.
+func (m UMap) TxDelete(tx *Tx, uid int64) {
+	strUID := strconv.FormatInt(uid, 10)
+	tx.delete(txOp{namespace: m.name, key: strUID}, func() {
+		(*m.lock).Lock()
+		defer (*m.lock).Unlock()
+		delete(m.data, uid)
+	})
+}
+
 // BatchPut puts an object into the vault by batching (leveldb).
 func (m UMap) BatchPut(uid int64, user *User) {
 	(*m.lock).Lock()
@@ -110,7 +142,7 @@ func (m UMap) BatchPut(uid int64, user *User) {
 	strUID := strconv.FormatInt(uid, 10)
 	strUser := user.Serialize()
 
-	m.batch.Put([]byte(strUID), strUser)
+	m.batch.Put(namespaceKey(m.name, strUID), strUser)
 }
 
 // BatchDelete deletes an object from the vault by batching (leveldb).
@@ -120,27 +152,123 @@ func (m UMap) BatchDelete(uid int64) {
 
 	strUID := strconv.FormatInt(uid, 10)
 
-	m.batch.Delete([]byte(strUID))
+	m.batch.Delete(namespaceKey(m.name, strUID))
 }
 
 // BatchWrite performs write of the batch to the database.
 func (m UMap) BatchWrite() error {
-	err := m.db.Write(m.batch, nil)
+	(*m.lock).Lock()
+	defer (*m.lock).Unlock()
+
+	err := m.db.ldb.Write(m.batch, nil)
+	m.batch.Reset()
 
 	return err
 }
 
 // Iterate brings possibility to iterate over the vault.
+// Returns a copy taken under the lock, so the vault can be changed while it's iterated.
 func (m UMap) Iterate() map[int64]*User {
-	return m.data
+	(*m.lock).RLock()
+	defer (*m.lock).RUnlock()
+
+	data := make(map[int64]*User, len(m.data))
+	for k, v := range m.data {
+		data[k] = v
+	}
+
+	return data
+}
+
+// Players returns users taking part in the game.
+func (m UMap) Players() []*User {
+	(*m.lock).RLock()
+	defer (*m.lock).RUnlock()
+
+	lst := []*User{}
+	for _, user := range m.data {
+		if user.GetIsPlayer() {
+			lst = append(lst, user)
+		}
+	}
+
+	return lst
+}
+
+// TicketHolders returns users having a ticket
+// sorted by last ticket purchase date, the most recent first.
+func (m UMap) TicketHolders() []*User {
+	lst := []*User{}
+	for _, user := range m.FormLastTicketDateList() {
+		if user.GetHasTicket() {
+			lst = append(lst, user)
+		}
+	}
+
+	return lst
+}
+
+// UpdateLeaderboard recalculates leaderboard positions of all the users
+// and returns the first n of the leaderboard.
+func (m UMap) UpdateLeaderboard(n int) []*User {
+	totalWonAmountLST := m.FormTotalWonAmountList()
+	leaderboard := make([]*User, len(totalWonAmountLST))
+	for i := len(totalWonAmountLST) - 1; i >= 0; i-- {
+		leaderboard[len(totalWonAmountLST)-i-1] = totalWonAmountLST[i]
+		totalWonAmountLST[i].SetLeaderboardPosition(uint32(len(totalWonAmountLST) - i))
+		m.BatchPut(totalWonAmountLST[i].GetUserID(), totalWonAmountLST[i])
+	}
+	if err := m.BatchWrite(); err != nil {
+		Error.Printf("Can't update leaderboard positions.")
+	}
+
+	return leaderboard[:Min(n, len(leaderboard))]
+}
+
+// list returns all the users of the vault.
+func (m UMap) list() []*User {
+	(*m.lock).RLock()
+	defer (*m.lock).RUnlock()
+
+	lst := make([]*User, len(m.data))
+	i := 0
+	for _, user := range m.data {
+		lst[i] = user
+		i++
+	}
+
+	return lst
+}
+
+// FormTotalWonAmountList forms list of *User sorted by total won amount.
+func (m UMap) FormTotalWonAmountList() []*User {
+	lst := MergesortJoinDate(m.list())
+	Reverse(&lst)
+	return MergesortTotalWonAmount(lst)
+}
+
+// FormLeaderboardPositionList forms list of *User sorted by position in the leaderboard.
+func (m UMap) FormLeaderboardPositionList() []*User {
+	lst := MergesortJoinDate(m.list())
+	Reverse(&lst)
+	return MergesortLeaderboardPosition(lst)
+}
+
+// FormLastTicketDateList forms list of *User sorted by last ticket purchase date.
+func (m UMap) FormLastTicketDateList() []*User {
+	lst := MergesortLastTicketDate(m.list())
+	Reverse(&lst)
+	return lst
+}
+
+// FormJoinDateList forms list of *User sorted by join date.
+func (m UMap) FormJoinDateList() []*User {
+	return MergesortJoinDate(m.list())
 }
 
 // Len returns length of the vault
 func (m UMap) Len() int {
+	(*m.lock).RLock()
+	defer (*m.lock).RUnlock()
 	return len(m.data)
 }
-
-// Close closes the database.
-func (m UMap) Close() {
-	m.db.Close()
-}
@@ -1,23 +1,69 @@
 package rps
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+// Version of the serialized User structure, written as the first byte of a record.
+// Records of the legacy pipe-delimited format start with a printable character
+// and are treated as version 0.
+const userFormatVersion byte = 1
+
+// userRecord is the serialized form of the User structure.
+// Fields can be added freely, missing ones get zero values on deserialization.
+type userRecord struct {
+	UserID              int64     `json:"userID"`
+	Subscribed          bool      `json:"subscribed"`
+	Tickets             []Ticket  `json:"tickets"`
+	IsPlayer            bool      `json:"isPlayer"`
+	LastWonAmount       float64   `json:"lastWonAmount"`
+	TotalWonAmount      float64   `json:"totalWonAmount"`
+	Balance             float64   `json:"balance"`
+	LeaderboardPosition uint32    `json:"leaderboardPosition"`
+	Name                string    `json:"name"`
+	WalletAddress       string    `json:"walletAddress"`
+	LastTicketDate      time.Time `json:"lastTicketDate"`
+	JoinDate            time.Time `json:"joinDate"`
+}
+
+// Ticket structure.
+// Zero Expires means the ticket never expires.
+type Ticket struct {
+	ID          uint64    `json:"id"`
+	Purchased   time.Time `json:"purchased"`
+	Expires     time.Time `json:"expires"`
+	FromBalance bool      `json:"fromBalance"`
+}
+
+// Expired checks if the ticket is expired at the moment.
+func (t Ticket) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && now.After(t.Expires)
+}
+
+// legacyTickets converts ticket status of the legacy records to the ticket list.
+func legacyTickets(hasTicket bool, date time.Time) []Ticket {
+	if !hasTicket {
+		return []Ticket{}
+	}
+
+	return []Ticket{{0, date, time.Time{}, false}}
+}
+
 // User structure.
 type User struct {
 	userID              int64
 	subscribed          bool
-	hasTicket           bool
+	tickets             []Ticket
 	isPlayer            bool
 	lastWonAmount       float64
 	totalWonAmount      float64
+	balance             float64
 	leaderboardPosition uint32
-	playSequence        string
 	name                string
 	walletAddress       string
 	lastTicketDate      time.Time
@@ -31,14 +77,16 @@ func NewUser(
 	subscribed, hasTicket, isPlayer bool,
 	leaderboardPosition uint32,
 ) User {
-	var playSequence, walletAddress string
-	var lastWonAmount, totalWonAmount float64
+	var walletAddress string
+	var lastWonAmount, totalWonAmount, balance float64
 	var lastTicketDate, joinDate time.Time
 	joinDate = time.Now()
+	tickets := legacyTickets(hasTicket, joinDate)
 	lock := sync.RWMutex{}
 
-	u := User{userID, subscribed, hasTicket, isPlayer, lastWonAmount, totalWonAmount,
-		leaderboardPosition, playSequence, name, walletAddress, lastTicketDate, joinDate, &lock}
+	u := User{userID, subscribed, tickets, isPlayer, lastWonAmount,
+		totalWonAmount, balance, leaderboardPosition, name, walletAddress,
+		lastTicketDate, joinDate, &lock}
 
 	return u
 }
@@ -57,11 +105,18 @@ func (u *User) GetSubscribed() bool {
 	return u.subscribed
 }
 
-// GetHasTicket performs non-blocking get of user's ticket status.
+// GetHasTicket performs non-blocking check if user has any ticket.
 func (u *User) GetHasTicket() bool {
 	(*u.lock).RLock()
 	defer (*u.lock).RUnlock()
-	return u.hasTicket
+	return len(u.tickets) > 0
+}
+
+// GetTickets performs non-blocking get of user's tickets.
+func (u *User) GetTickets() []Ticket {
+	(*u.lock).RLock()
+	defer (*u.lock).RUnlock()
+	return append([]Ticket{}, u.tickets...)
 }
 
 // GetIsPlayer performs non-blocking get of user's player status.
@@ -85,18 +140,18 @@ func (u *User) GetTotalWonAmount() float64 {
 	return u.totalWonAmount
 }
 
-// GetLeaderboardPosition performs non-blocking get of user's leaderboard position.
-func (u *User) GetLeaderboardPosition() uint32 {
+// GetBalance performs non-blocking get of user's internal balance.
+func (u *User) GetBalance() float64 {
 	(*u.lock).RLock()
 	defer (*u.lock).RUnlock()
-	return u.leaderboardPosition
+	return u.balance
 }
 
-// GetPlaySequence performs non-blocking get of user's play sequence.
-func (u *User) GetPlaySequence() string {
+// GetLeaderboardPosition performs non-blocking get of user's leaderboard position.
+func (u *User) GetLeaderboardPosition() uint32 {
 	(*u.lock).RLock()
 	defer (*u.lock).RUnlock()
-	return u.playSequence
+	return u.leaderboardPosition
 }
 
 // GetName performs non-blocking get of user's name.
@@ -141,11 +196,47 @@ func (u *User) SetSubscribed(val bool) {
 	u.subscribed = val
 }
 
-// SetHasTicket performs non-blocking set of user's ticket status.
-func (u *User) SetHasTicket(val bool) {
+// SetTickets performs non-blocking set of user's tickets.
+func (u *User) SetTickets(val []Ticket) {
+	(*u.lock).Lock()
+	defer (*u.lock).Unlock()
+	u.tickets = append([]Ticket{}, val...)
+}
+
+// AddTickets performs non-blocking addition of tickets to the user.
+func (u *User) AddTickets(val ...Ticket) {
+	(*u.lock).Lock()
+	defer (*u.lock).Unlock()
+	u.tickets = append(u.tickets, val...)
+}
+
+// TakeTicket performs non-blocking removal of the oldest user's ticket and returns it.
+func (u *User) TakeTicket() (Ticket, bool) {
 	(*u.lock).Lock()
 	defer (*u.lock).Unlock()
-	u.hasTicket = val
+	if len(u.tickets) == 0 {
+		return Ticket{}, false
+	}
+	ticket := u.tickets[0]
+	u.tickets = u.tickets[1:]
+	return ticket, true
+}
+
+// TakeExpiredTickets performs non-blocking removal of user's tickets expired at the moment
+// and returns them.
+func (u *User) TakeExpiredTickets(now time.Time) []Ticket {
+	(*u.lock).Lock()
+	defer (*u.lock).Unlock()
+	expired, valid := []Ticket{}, []Ticket{}
+	for _, t := range u.tickets {
+		if t.Expired(now) {
+			expired = append(expired, t)
+		} else {
+			valid = append(valid, t)
+		}
+	}
+	u.tickets = valid
+	return expired
 }
 
 // SetIsPlayer performs non-blocking set of user's player status.
@@ -169,18 +260,38 @@ func (u *User) SetTotalWonAmount(val float64) {
 	u.totalWonAmount = val
 }
 
-// SetLeaderboardPosition performs non-blocking set of user's leaderboard position.
-func (u *User) SetLeaderboardPosition(val uint32) {
+// SetBalance performs non-blocking set of user's internal balance.
+func (u *User) SetBalance(val float64) {
 	(*u.lock).Lock()
 	defer (*u.lock).Unlock()
-	u.leaderboardPosition = val
+	u.balance = val
+}
+
+// AddBalance performs non-blocking addition to user's internal balance and returns the new one.
+func (u *User) AddBalance(val float64) float64 {
+	(*u.lock).Lock()
+	defer (*u.lock).Unlock()
+	u.balance += val
+	return u.balance
+}
+
+// Debit performs non-blocking subtraction of the amount from user's internal balance
+// if the balance covers it.
+func (u *User) Debit(amount float64) bool {
+	(*u.lock).Lock()
+	defer (*u.lock).Unlock()
+	if u.balance < amount {
+		return false
+	}
+	u.balance -= amount
+	return true
 }
 
-// SetPlaySequence performs non-blocking set of user's play sequence.
-func (u *User) SetPlaySequence(val string) {
+// SetLeaderboardPosition performs non-blocking set of user's leaderboard position.
+func (u *User) SetLeaderboardPosition(val uint32) {
 	(*u.lock).Lock()
 	defer (*u.lock).Unlock()
-	u.playSequence = val
+	u.leaderboardPosition = val
 }
 
 // SetName performs non-blocking set of user's name.
@@ -213,19 +324,69 @@ func (u *User) SetJoinDate(date time.Time) {
 
 // Serialize performs serialization of the User structure.
 func (u *User) Serialize() []byte {
-	return []byte(fmt.Sprintf("UserID: %d|Subscribed: %t|HasTicket: %t|IsPlayer: %t|"+
-		"LastWonAmount: %f|TotalWonAmount: %f|LeaderboardPosition: %d|PlaySequence: %s|"+
-		"Name: %s|WalletAddress: %s|LastTicketDate: %s|JoinDate: %s",
-		u.userID, u.subscribed, u.hasTicket, u.isPlayer, u.lastWonAmount, u.totalWonAmount,
-		u.leaderboardPosition, u.playSequence, u.name, u.walletAddress,
-		u.lastTicketDate.Format(time.RFC1123), u.joinDate.Format(time.RFC1123)),
-	)
+	(*u.lock).RLock()
+	record := userRecord{
+		u.userID, u.subscribed, append([]Ticket{}, u.tickets...),
+		u.isPlayer, u.lastWonAmount, u.totalWonAmount, u.balance, u.leaderboardPosition, u.name, u.walletAddress,
+		u.lastTicketDate, u.joinDate,
+	}
+	(*u.lock).RUnlock()
+
+	// Marshaling of plain fields can't fail
+	data, _ := json.Marshal(record)
+
+	return append([]byte{userFormatVersion}, data...)
 }
 
 // Deserialize performs deserialization of the User structure.
+// Accepts records of any known version.
 func Deserialize(data []byte) (User, error) {
+	switch userRecordVersion(data) {
+	case 0:
+		return deserializeLegacy(data)
+	case 1:
+		return deserializeV1(data[1:])
+	default:
+		return User{}, errors.New("unsupported user record version")
+	}
+}
+
+// userRecordVersion returns version of the serialized user record.
+func userRecordVersion(data []byte) byte {
+	if len(data) == 0 || data[0] >= ' ' {
+		return 0
+	}
+
+	return data[0]
+}
+
+func deserializeV1(data []byte) (User, error) {
+	var record userRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return User{}, err
+	}
+	lock := sync.RWMutex{}
+
+	tickets := record.Tickets
+	if tickets == nil {
+		tickets = []Ticket{}
+	}
+
+	u := User{record.UserID, record.Subscribed, tickets, record.IsPlayer, record.LastWonAmount, record.TotalWonAmount, record.Balance, record.LeaderboardPosition,
+		record.Name, record.WalletAddress,
+		record.LastTicketDate, record.JoinDate, &lock}
+
+	return u, nil
+}
+
+// deserializeLegacy performs deserialization of the pipe-delimited format
+// used before versioning was introduced.
+func deserializeLegacy(data []byte) (User, error) {
 	strData := string(data)
 	d := strings.Split(strData, "|")
+	if len(d) != 12 {
+		return User{}, errors.New("malformed legacy user record")
+	}
 
 	strUserID := d[0][strings.Index(d[0], " ")+1:]
 	userID, err := strconv.ParseInt(strUserID, 10, 64)
@@ -263,7 +424,8 @@ func Deserialize(data []byte) (User, error) {
 		return User{}, err
 	}
 	leaderboardPosition := uint32(_leaderboardPosition)
-	playSequence := d[7][strings.Index(d[7], " ")+1:]
+	balance := 0.0
+	// d[7] is the play sequence, moves aren't kept in the user anymore
 	name := d[8][strings.Index(d[8], " ")+1:]
 	walletAddress := d[9][strings.Index(d[9], " ")+1:]
 	strLastTicketDate := d[10][strings.Index(d[10], " ")+1:]
@@ -278,8 +440,11 @@ func Deserialize(data []byte) (User, error) {
 	}
 	lock := sync.RWMutex{}
 
-	u := User{userID, subscribed, hasTicket, isPlayer, lastWonAmount, totalWonAmount,
-		leaderboardPosition, playSequence, name, walletAddress, lastTicketDate, joinDate, &lock}
+	tickets := legacyTickets(hasTicket, lastTicketDate)
+
+	u := User{userID, subscribed, tickets, isPlayer, lastWonAmount,
+		totalWonAmount, balance, leaderboardPosition, name, walletAddress,
+		lastTicketDate, joinDate, &lock}
 
 	return u, err
 }
@@ -0,0 +1,97 @@
+package rps
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUserDebit(t *testing.T) {
+	user := NewUser(1, "user1", true, false, false, 0)
+	user.SetBalance(0.003)
+
+	if user.Debit(0.004) {
+		t.Error("amount over the balance is debited")
+	}
+	if !user.Debit(0.002) {
+		t.Error("amount covered by the balance isn't debited")
+	}
+	if balance := user.GetBalance(); balance < 0.000999 || balance > 0.001001 {
+		t.Errorf("balance after the debit is %f", balance)
+	}
+}
+
+func TestUserDebitConcurrent(t *testing.T) {
+	user := NewUser(1, "user1", true, false, false, 0)
+	user.SetBalance(10)
+
+	// Only as many debits as the balance covers pass
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	debited := 0
+	wg.Add(50)
+	for i := 0; i < 50; i++ {
+		go func() {
+			defer wg.Done()
+			if user.Debit(1) {
+				lock.Lock()
+				debited++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if debited != 10 || user.GetBalance() != 0 {
+		t.Errorf("%d debits passed, balance is %f", debited, user.GetBalance())
+	}
+}
+
+func TestUserSerialize(t *testing.T) {
+	user := NewUser(1, "user1", true, false, false, 0)
+	purchased := time.Unix(1500000000, 0).UTC()
+	user.AddTickets(Ticket{1, purchased, purchased.Add(time.Hour), false}, Ticket{2, purchased, time.Time{}, true})
+
+	restored, err := Deserialize(user.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tickets := restored.GetTickets()
+	if len(tickets) != 2 || tickets[0].ID != 1 || !tickets[0].Expires.Equal(purchased.Add(time.Hour)) ||
+		tickets[1].ID != 2 || !tickets[1].FromBalance {
+		t.Errorf("tickets are restored as %v", tickets)
+	}
+	if restored.GetName() != "user1" || !restored.GetSubscribed() {
+		t.Errorf("user is restored as %q, subscribed %t", restored.GetName(), restored.GetSubscribed())
+	}
+
+	// User without tickets has an empty list of them
+	empty := NewUser(2, "user2", true, false, false, 0)
+	restored, err = Deserialize(empty.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tickets := restored.GetTickets(); tickets == nil || len(tickets) != 0 {
+		t.Errorf("tickets are restored as %v", tickets)
+	}
+}
+
+func TestUserDeserializeLegacy(t *testing.T) {
+	date := time.Unix(1500000000, 0).UTC().Format(time.RFC1123)
+	data := "UserID: 1|Subscribed: true|HasTicket: true|IsPlayer: false|LastWonAmount: 0.5|" +
+		"TotalWonAmount: 1.5|LeaderboardPosition: 3|PlaySequence: RP|Name: user1|WalletAddress: |" +
+		"LastTicketDate: " + date + "|JoinDate: " + date
+
+	user, err := Deserialize([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tickets := user.GetTickets()
+	if len(tickets) != 1 || tickets[0].ID != 0 || tickets[0].FromBalance || !tickets[0].Expires.IsZero() {
+		t.Errorf("ticket of the legacy record is restored as %v", tickets)
+	}
+	if user.GetUserID() != 1 || user.GetTotalWonAmount() != 1.5 || user.GetLeaderboardPosition() != 3 {
+		t.Errorf("legacy record is restored as %d, %f, %d",
+			user.GetUserID(), user.GetTotalWonAmount(), user.GetLeaderboardPosition())
+	}
+}
@@ -2,12 +2,12 @@ package rps
 
 // Users structure.
 type Users struct {
-	data UMap
+	data UserStore
 }
 
 // NewUsers creates an object of Users structure.
-func NewUsers(name string, dbPath string) Users {
-	data := NewUMap(name, dbPath)
+func NewUsers(name string, storage Storage) Users {
+	data := storage.Users(name)
 
 	return Users{data}
 }
@@ -58,71 +58,34 @@ func (u Users) BatchWrite() error {
 	return u.data.BatchWrite()
 }
 
-// Iterate brings possibility to iterate over the vault.
-func (u Users) Iterate() map[int64]*User {
-	return u.data.Iterate()
-}
-
 // Len returns length of the vault
 func (u Users) Len() int {
 	return u.data.Len()
 }
 
-// Close closes the database.
-func (u Users) Close() {
-	u.data.Close()
+// Players returns users taking part in the game.
+func (u Users) Players() []*User {
+	return u.data.Players()
 }
 
-// FormTotalWonAmountList forms list of *User sorted by total won amount.
-func (u Users) FormTotalWonAmountList() []*User {
-	lst := make([]*User, u.data.Len())
-	i := 0
-	for _, user := range u.data.Iterate() {
-		lst[i] = user
-		i++
-	}
-
-	lst = MergesortJoinDate(lst)
-	Reverse(&lst)
-	return MergesortTotalWonAmount(lst)
+// TicketHolders returns users having a ticket
+// sorted by last ticket purchase date, the most recent first.
+func (u Users) TicketHolders() []*User {
+	return u.data.TicketHolders()
 }
 
-// FormLeaderboardPositionList forms list of *User sorted by position in the leaderboard.
-func (u Users) FormLeaderboardPositionList() []*User {
-	lst := make([]*User, u.data.Len())
-	i := 0
-	for _, user := range u.data.Iterate() {
-		lst[i] = user
-		i++
-	}
-
-	lst = MergesortJoinDate(lst)
-	Reverse(&lst)
-	return MergesortLeaderboardPosition(lst)
+// UpdateLeaderboard recalculates leaderboard positions of all the users
+// and returns the first n of the leaderboard.
+func (u Users) UpdateLeaderboard(n int) []*User {
+	return u.data.UpdateLeaderboard(n)
 }
 
-// FormLastTicketDateList forms list of *User sorted by last ticket purchase date.
-func (u Users) FormLastTicketDateList() []*User {
-	lst := make([]*User, u.data.Len())
-	i := 0
-	for _, user := range u.data.Iterate() {
-		lst[i] = user
-		i++
-	}
-
-	lst = MergesortLastTicketDate(lst)
-	Reverse(&lst)
-	return lst
+// TxPut puts an object into the vault as a part of the transaction.
+func (u Users) TxPut(tx *Tx, uid int64, user *User) {
+	u.data.TxPut(tx, uid, user)
 }
 
-// FormJoinDateList forms list of *User sorted by join date.
-func (u Users) FormJoinDateList() []*User {
-	lst := make([]*User, u.data.Len())
-	i := 0
-	for _, user := range u.data.Iterate() {
-		lst[i] = user
-		i++
-	}
-
-	return MergesortJoinDate(lst)
+// TxDelete deletes an object from the vault as a part of the transaction.
+func (u Users) TxDelete(tx *Tx, uid int64) {
+	u.data.TxDelete(tx, uid)
 }